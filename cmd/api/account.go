@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hafizmfadli/go-movie/internal/data"
+	"github.com/hafizmfadli/go-movie/internal/validator"
+)
+
+// exportCurrentUserHandler for the "GET /v1/users/me/export" endpoint. It returns
+// everything we store about the user as a downloadable JSON document.
+func (app *application) exportCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	roles, err := app.models.Roles.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	sessions, err := app.models.Tokens.GetAllForUser(data.ScopeRefresh, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	apiKeys, err := app.models.APIKeys.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	identities, err := app.models.Identities.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	reviews, err := app.models.Reviews.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	watchlist, err := app.models.Watchlist.GetAllForExport(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	history, err := app.models.History.GetAllForExport(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	revisions, err := app.models.Revisions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	twoFactorEnabled := false
+
+	t, err := app.models.TOTP.Get(user.ID)
+	switch {
+	case err == nil:
+		twoFactorEnabled = t.Enabled
+	case !errors.Is(err, data.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"exported_at":        time.Now().UTC(),
+		"user":               user,
+		"roles":              roles,
+		"permissions":        permissions,
+		"sessions":           sessions,
+		"api_keys":           apiKeys,
+		"identities":         identities,
+		"reviews":            reviews,
+		"watchlist":          watchlist,
+		"history":            history,
+		"revisions":          revisions,
+		"two_factor_enabled": twoFactorEnabled,
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="netflix-export-%d.json"`, user.ID))
+
+	err = app.writeJSON(w, http.StatusOK, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCurrentUserHandler for the "DELETE /v1/users/me" endpoint. It requires the
+// user to re-enter their password. The account isn't deleted straight away, but is
+// kept for a grace period in which the user can change their mind.
+func (app *application) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidatePasswordPlaintext(v, input.Password); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	deletionDate := time.Now().Add(app.config.deletion.gracePeriod)
+
+	err = app.models.Users.ScheduleDeletion(user.ID, deletionDate)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		data := map[string]interface{}{
+			"deletionDate": deletionDate.Format(time.RFC1123),
+		}
+
+		err := app.mailer.Send(user.Email, "account_deletion.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	env := envelope{
+		"message":       "your account is scheduled for deletion, and an email will be sent to you containing the details",
+		"deletion_date": deletionDate,
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// cancelCurrentUserDeletionHandler for the "DELETE /v1/users/me/deletion" endpoint.
+func (app *application) cancelCurrentUserDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.models.Users.CancelDeletion(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "account deletion successfully cancelled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runDeletionJob starts a background goroutine which periodically deletes the accounts
+// whose grace period has passed, until ctx is cancelled.
+func (app *application) runDeletionJob(ctx context.Context) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(app.config.deletion.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				app.deleteScheduledUsers()
+			}
+		}
+	}()
+}
+
+// deleteScheduledUsers runs a single pass of the deletion job. Panics are recovered so
+// that one bad pass doesn't stop the job for good.
+func (app *application) deleteScheduledUsers() {
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.PrintError(fmt.Errorf("%s", err), nil)
+		}
+	}()
+
+	n, err := app.models.Users.DeleteScheduled()
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	if n > 0 {
+		app.logger.PrintInfo("deleted scheduled accounts", map[string]string{
+			"count": fmt.Sprint(n),
+		})
+	}
+}
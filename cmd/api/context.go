@@ -33,3 +33,66 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// Convert the string "token" to a contextKey type and assign it to the tokenContextKey
+// constant. We'll use this constant as the key for getting and setting the plaintext
+// authentication token that was used to authenticate the request.
+const tokenContextKey = contextKey("token")
+
+// contextSetToken returns a new copy of the request with the provided plaintext
+// authentication token added to the context.
+func (app *application) contextSetToken(r *http.Request, token string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+// contextGetToken retrieves the plaintext authentication token from the request context.
+// Like contextGetUser, we only use this helper when we logically expect the request to be
+// authenticated, so a missing value is an 'unexpected' error.
+func (app *application) contextGetToken(r *http.Request) string {
+	token, ok := r.Context().Value(tokenContextKey).(string)
+	if !ok {
+		panic("missing token value in request context")
+	}
+	return token
+}
+
+// Convert the string "permissions" to a contextKey type and assign it to the
+// permissionsContextKey constant. It is only set when the permissions of the user are
+// already known while authenticating the request (for example, because they were
+// carried in a JWT), so that we don't need to look them up again.
+const permissionsContextKey = contextKey("permissions")
+
+// contextSetPermissions returns a new copy of the request with the provided
+// permissions added to the context.
+func (app *application) contextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+// contextGetPermissions retrieves the permissions from the request context. Unlike
+// the other context helpers, a missing value is expected, and is reported by
+// returning false.
+func (app *application) contextGetPermissions(r *http.Request) (data.Permissions, bool) {
+	permissions, ok := r.Context().Value(permissionsContextKey).(data.Permissions)
+	return permissions, ok
+}
+
+// Convert the string "apiKey" to a contextKey type and assign it to the
+// apiKeyContextKey constant. It is only set when the request was authenticated with
+// an API key.
+const apiKeyContextKey = contextKey("apiKey")
+
+// contextSetAPIKey returns a new copy of the request with the provided API key
+// added to the context.
+func (app *application) contextSetAPIKey(r *http.Request, apiKey *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, apiKey)
+	return r.WithContext(ctx)
+}
+
+// contextGetAPIKey retrieves the API key from the request context. It returns false
+// if the request wasn't authenticated with an API key.
+func (app *application) contextGetAPIKey(r *http.Request) (*data.APIKey, bool) {
+	apiKey, ok := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return apiKey, ok
+}
@@ -1,6 +1,11 @@
 package main
 
-import "net/http"
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
 
 // logError is generic helper for logging error message.
 func (app *application) logError(r *http.Request, err error) {
@@ -55,11 +60,49 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, http.StatusText(http.StatusConflict))
 }
 
+// preconditionFailedResponse will be used to send a 412 Precondition Failed status code with JSON
+// formatted. This error helper is used when the If-Match header of a request doesn't match the
+// current entity tag of the resource.
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has been modified since you fetched it, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+// versionConflictResponse will be used when a versioned change loses a race with another change
+// to the same resource. It sends a 412 Precondition Failed to clients which sent an If-Match
+// header, and a 409 Conflict to the others.
+func (app *application) versionConflictResponse(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("If-Match") != "" {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	app.editConflictResponse(w, r)
+}
+
 // rateLimitExceededResponse will be used to send a 429 Too Many Requests status code with JSON formatted
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	app.errorResponse(w, r, http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests))
 }
 
+// loginThrottledResponse will be used to send a 429 Too Many Requests status code with JSON formatted.
+// This error helper is used when the client must wait before trying to log in again. The Retry-After
+// header tells the client how many seconds to wait.
+func (app *application) loginThrottledResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	message := "too many failed login attempts, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+// magicLinkThrottledResponse will be used to send a 429 Too Many Requests status code with JSON
+// formatted. This error helper is used when too many magic links have been requested for an email
+// address. The Retry-After header tells the client how many seconds to wait.
+func (app *application) magicLinkThrottledResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	message := "too many login links have been requested for this email address, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
 // invalidCredentialsResponse will be used to send a 401 Unauthorized status code with JSON formatted.
 // This error helper is used when credential that provided by client is invalid
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// hashETag returns a strong entity tag made from a hash of the JSON encoding of data.
+func hashETag(data interface{}) (string, error) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(js)
+
+	return `"` + hex.EncodeToString(hash[:8]) + `"`, nil
+}
+
+// versionETag returns the strong entity tag for a single versioned resource, such as a
+// movie. It is made from the version alone, so it only changes when the resource itself
+// does, and it is the same for every client.
+func versionETag(version int32) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// etagList splits the value of an If-Match or If-None-Match header into its entity
+// tags.
+func etagList(header string) []string {
+	var etags []string
+
+	for _, etag := range strings.Split(header, ",") {
+		etag = strings.TrimSpace(etag)
+		if etag != "" {
+			etags = append(etags, etag)
+		}
+	}
+
+	return etags
+}
+
+// notModified reports whether the If-None-Match header of the request matches etag,
+// in which case the client already has the current representation and should be sent
+// a 304 Not Modified response. If-None-Match uses the weak comparison, so the W/
+// prefix of weak tags is ignored.
+func notModified(r *http.Request, etag string) bool {
+	for _, candidate := range etagList(r.Header.Get("If-None-Match")) {
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifMatch reports whether the If-Match header of the request matches etag. Requests
+// without the header always match. If-Match uses the strong comparison, so weak tags
+// never match.
+func ifMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	for _, candidate := range etagList(header) {
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeNotModified sends a 304 Not Modified response with the given entity tag.
+func (app *application) writeNotModified(w http.ResponseWriter, etag string) {
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusNotModified)
+}
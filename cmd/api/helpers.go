@@ -178,6 +178,26 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return res
 }
 
+// readFloat helper reads a string value from the query string and converts it to a float
+// before returning. If no matching key could be found it returns the provided default value.
+// If the value couldn't be converted to a float, then we record an error message in the
+// provided Validator instance.
+func (app *application) readFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	res, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		v.AddError(key, "must be a number")
+		return defaultValue
+	}
+
+	return res
+}
+
 // background accepts arbitrary function as parameter. Panic recovery is added
 // to handle panic when fn is executed in background goroutine
 func (app *application) background(fn func()) {
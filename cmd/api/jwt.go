@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hafizmfadli/go-movie/internal/data"
+	"github.com/hafizmfadli/go-movie/internal/jwt"
+)
+
+// accessTokenClaims are the claims carried by a JWT access token. They contain
+// everything the authenticate and requirePermission middleware need, so that a request
+// made with a JWT can be authorized without a database round trip.
+type accessTokenClaims struct {
+	jwt.RegisteredClaims
+	Activated   bool             `json:"activated"`
+	Permissions data.Permissions `json:"permissions"`
+	// FamilyID is the token family of the refresh token which the access token was
+	// issued alongside. It lets us revoke the refresh token when the user logs out.
+	FamilyID int64 `json:"sid"`
+}
+
+// userID returns the ID of the user that the token was issued to.
+func (c accessTokenClaims) userID() (int64, error) {
+	return strconv.ParseInt(c.Subject, 10, 64)
+}
+
+// isJWT reports whether the application is running in JWT mode and the token looks
+// like a JWT rather than one of our random plaintext tokens.
+func (app *application) isJWT(token string) bool {
+	return app.jwtKeys != nil && strings.Count(token, ".") == 2
+}
+
+// createAccessJWT returns a signed JWT access token for a user. Note that the
+// permissions are fixed at the time the token is issued, so any changes to them only
+// take effect when the token is refreshed.
+func (app *application) createAccessJWT(user *data.User, familyID int64, ttl time.Duration) (*data.Token, error) {
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	claims := accessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatInt(user.ID, 10),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		},
+		Activated:   user.Activated,
+		Permissions: permissions,
+		FamilyID:    familyID,
+	}
+
+	plaintext, err := app.jwtKeys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &data.Token{
+		Plaintext:  plaintext,
+		UserID:     user.ID,
+		Expiry:     time.Unix(claims.ExpiresAt, 0),
+		Scope:      data.ScopeAuthentication,
+		FamilyID:   familyID,
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+
+	return token, nil
+}
+
+// verifyAccessJWT checks the signature and expiry of a JWT access token and returns
+// its claims.
+func (app *application) verifyAccessJWT(token string) (*accessTokenClaims, error) {
+	var claims accessTokenClaims
+
+	err := app.jwtKeys.Verify(token, &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
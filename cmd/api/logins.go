@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hafizmfadli/go-movie/internal/data"
+	"github.com/tomasen/realip"
+)
+
+// loginRetryAfter returns how long the client must wait before it may try to log in to
+// the account with the given email address. Failed attempts are tracked both per
+// account and per IP address, and the longer wait of the two applies. The per-IP
+// tracking catches one client guessing passwords for many accounts, while the
+// per-account tracking catches many clients guessing the password for one account.
+func (app *application) loginRetryAfter(r *http.Request, email string) (time.Duration, error) {
+	var retryAfter time.Duration
+
+	subjects := map[string]string{
+		data.LoginFailureAccount: strings.ToLower(email),
+		data.LoginFailureIP:      realip.FromRequest(r),
+	}
+
+	for kind, subject := range subjects {
+		f, err := app.models.LoginFailures.Get(kind, subject)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				continue
+			}
+			return 0, err
+		}
+
+		if wait := f.RetryAfter(time.Now()); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	return retryAfter, nil
+}
+
+// recordLoginFailure records a failed login attempt against both the account and the
+// client IP address. If this locks the account of an existing user, we let them know
+// by email. user is nil when there is no user with the email address.
+func (app *application) recordLoginFailure(r *http.Request, email string, user *data.User) error {
+	_, _, err := app.models.LoginFailures.Record(data.LoginFailureIP, realip.FromRequest(r), app.config.lockout.maxIPFailures, app.config.lockout.duration)
+	if err != nil {
+		return err
+	}
+
+	f, locked, err := app.models.LoginFailures.Record(data.LoginFailureAccount, strings.ToLower(email), app.config.lockout.maxFailures, app.config.lockout.duration)
+	if err != nil {
+		return err
+	}
+
+	if locked && user != nil {
+		app.logger.PrintInfo("account locked after too many failed login attempts", map[string]string{
+			"user_id":      strconv.FormatInt(user.ID, 10),
+			"locked_until": f.LockedUntil.Format(time.RFC3339),
+		})
+
+		app.background(func() {
+			data := map[string]interface{}{
+				"lockedUntil": f.LockedUntil.Format(time.RFC1123),
+			}
+
+			err := app.mailer.Send(user.Email, "account_locked.tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+
+	return nil
+}
+
+// resetLoginFailures forgets the failed login attempts for an account after the user
+// has logged in successfully. We deliberately leave the IP address alone, otherwise an
+// attacker could reset their own count by logging in to an account they control.
+func (app *application) resetLoginFailures(email string) error {
+	err := app.models.LoginFailures.Delete(data.LoginFailureAccount, strings.ToLower(email))
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return err
+	}
+	return nil
+}
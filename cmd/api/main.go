@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"expvar"
 	"flag"
 	"fmt"
+	"math"
 	"os"
 	"runtime"
 	"strings"
@@ -14,8 +16,11 @@ import (
 
 	"github.com/hafizmfadli/go-movie/internal/data"
 	"github.com/hafizmfadli/go-movie/internal/jsonlog"
+	"github.com/hafizmfadli/go-movie/internal/jwt"
 	"github.com/hafizmfadli/go-movie/internal/mailer"
+	"github.com/hafizmfadli/go-movie/internal/oidc"
 	_ "github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -27,7 +32,6 @@ var (
 	buildTime string
 )
 
-
 // config struct hold all the configuration settings for out application.
 type config struct {
 
@@ -67,6 +71,71 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+
+	// auth struct hold the authentication token settings. In "token" mode access
+	// tokens are random strings which are looked up in the database on every request.
+	// In "jwt" mode they are signed JWTs which are validated without hitting the database.
+	auth struct {
+		mode          string
+		jwtKeys       []string
+		jwtSigningKey string
+	}
+
+	// password struct hold the password hashing settings. Changing them doesn't
+	// invalidate existing hashes: they are upgraded when each user next logs in.
+	password struct {
+		hasher            string
+		bcryptCost        int
+		argon2Memory      uint
+		argon2Iterations  uint
+		argon2Parallelism uint
+	}
+
+	// the role which is assigned to newly registered users
+	defaultRole string
+
+	// when inviteOnly is true, users can only register with an invitation from an admin
+	inviteOnly bool
+
+	// lockout struct hold the brute-force protection settings for logins. The number of
+	// failed attempts allowed before a lock is tracked separately per account and per IP.
+	lockout struct {
+		maxFailures   int
+		maxIPFailures int
+		duration      time.Duration
+	}
+
+	// magicLink struct hold the passwordless login settings. The number of magic links
+	// which can be requested for one email address is limited per window.
+	magicLink struct {
+		maxRequests int
+		window      time.Duration
+	}
+
+	// oidc struct hold the single sign-on settings. The OpenID Connect providers are
+	// configured in a JSON file, because they include client secrets.
+	oidc struct {
+		providersFile string
+	}
+
+	// totp struct hold the two-factor authentication settings
+	totp struct {
+		issuer string
+	}
+
+	// deletion struct hold the account deletion settings. Deleted accounts are kept
+	// for a grace period, and a background job removes them once it has passed.
+	deletion struct {
+		gracePeriod time.Duration
+		interval    time.Duration
+	}
+
+	// trash struct hold the movie trash settings. Deleted movies are kept in the trash
+	// for a retention period, and a background job purges them once it has passed.
+	trash struct {
+		retention time.Duration
+		interval  time.Duration
+	}
 }
 
 // application struct hold the dependencies for our HTTP handlers, helpers, and middleware.
@@ -75,6 +144,10 @@ type application struct {
 	logger *jsonlog.Logger
 	models data.Models
 	mailer mailer.Mailer
+	// jwtKeys is only set when the authentication mode is "jwt"
+	jwtKeys *jwt.KeySet
+	// oidcProviders holds the configured OpenID Connect providers, keyed by name
+	oidcProviders map[string]*oidc.Provider
 	// sync.WaitGroup is used to coordinate the graceful shutdown and our background goroutine
 	wg sync.WaitGroup
 }
@@ -102,6 +175,33 @@ func main() {
 		cfg.cors.trustedOrigins = strings.Fields(s)
 		return nil
 	})
+	flag.StringVar(&cfg.auth.mode, "auth-mode", "token", "Authentication token mode (token|jwt)")
+	// JWT keys are secrets, so they can also be provided with environment variables
+	// rather than on the command line.
+	cfg.auth.jwtKeys = strings.Fields(os.Getenv("NETFLIX_JWT_KEYS"))
+	flag.Func("jwt-keys", "JWT keys as <kid>:<hs256|ed25519|ed25519-public>:<base64 key> (space separated, default $NETFLIX_JWT_KEYS)", func(s string) error {
+		cfg.auth.jwtKeys = strings.Fields(s)
+		return nil
+	})
+	flag.StringVar(&cfg.password.hasher, "password-hasher", "bcrypt", "Password hashing algorithm (bcrypt|argon2id)")
+	flag.IntVar(&cfg.password.bcryptCost, "bcrypt-cost", 12, "bcrypt cost")
+	flag.UintVar(&cfg.password.argon2Memory, "argon2-memory", 64*1024, "Argon2id memory in KiB")
+	flag.UintVar(&cfg.password.argon2Iterations, "argon2-iterations", 3, "Argon2id iterations")
+	flag.UintVar(&cfg.password.argon2Parallelism, "argon2-parallelism", 2, "Argon2id parallelism")
+	flag.StringVar(&cfg.defaultRole, "default-role", "viewer", "Role assigned to newly registered users")
+	flag.BoolVar(&cfg.inviteOnly, "invite-only", false, "Only allow users with an invitation to register")
+	flag.IntVar(&cfg.lockout.maxFailures, "lockout-max-failures", 10, "Failed logins allowed per account before it is locked")
+	flag.IntVar(&cfg.lockout.maxIPFailures, "lockout-max-ip-failures", 50, "Failed logins allowed per IP address before it is locked")
+	flag.DurationVar(&cfg.lockout.duration, "lockout-duration", 15*time.Minute, "How long accounts and IP addresses are locked for")
+	flag.IntVar(&cfg.magicLink.maxRequests, "magic-link-max-requests", 5, "Magic links which can be requested per email address in each window")
+	flag.DurationVar(&cfg.magicLink.window, "magic-link-window", time.Hour, "Window over which magic link requests are limited")
+	flag.StringVar(&cfg.oidc.providersFile, "oidc-providers-file", "", "Path to a JSON file configuring OpenID Connect providers")
+	flag.StringVar(&cfg.totp.issuer, "totp-issuer", "Netflix", "Issuer name shown in authenticator apps")
+	flag.DurationVar(&cfg.deletion.gracePeriod, "deletion-grace-period", 30*24*time.Hour, "How long deleted accounts are kept before they are removed")
+	flag.DurationVar(&cfg.deletion.interval, "deletion-interval", time.Hour, "How often to remove accounts whose grace period has passed")
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted movies are kept in the trash before they are purged")
+	flag.DurationVar(&cfg.trash.interval, "trash-purge-interval", time.Hour, "How often to purge movies whose retention period has passed")
+	flag.StringVar(&cfg.auth.jwtSigningKey, "jwt-signing-key", os.Getenv("NETFLIX_JWT_SIGNING_KEY"), "ID of the JWT key used to sign new tokens (default first key)")
 
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
@@ -117,6 +217,47 @@ func main() {
 	// severity level to the standard out stream
 	logger := jsonlog.NewLogger(os.Stdout, jsonlog.LevelInfo)
 
+	var jwtKeys *jwt.KeySet
+
+	switch cfg.auth.mode {
+	case "token":
+	case "jwt":
+		var err error
+		jwtKeys, err = openJWTKeySet(cfg)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	default:
+		logger.PrintFatal(fmt.Errorf("invalid auth mode %q", cfg.auth.mode), nil)
+	}
+
+	// time.NewTicker panics on a non-positive interval, so the settings of the deletion
+	// and purge jobs are checked here instead of when the jobs start.
+	if cfg.deletion.gracePeriod <= 0 {
+		logger.PrintFatal(fmt.Errorf("deletion grace period must be positive, got %s", cfg.deletion.gracePeriod), nil)
+	}
+	if cfg.deletion.interval <= 0 {
+		logger.PrintFatal(fmt.Errorf("deletion interval must be positive, got %s", cfg.deletion.interval), nil)
+	}
+	if cfg.trash.retention <= 0 {
+		logger.PrintFatal(fmt.Errorf("trash retention must be positive, got %s", cfg.trash.retention), nil)
+	}
+	if cfg.trash.interval <= 0 {
+		logger.PrintFatal(fmt.Errorf("trash purge interval must be positive, got %s", cfg.trash.interval), nil)
+	}
+
+	passwordHasher, err := openPasswordHasher(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	data.PasswordHasher = passwordHasher
+
+	oidcProviders, err := openOIDCProviders(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	db, err := openDB(cfg)
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -125,6 +266,18 @@ func main() {
 
 	logger.PrintInfo("database connection pool established", nil)
 
+	models := data.NewModels(db)
+
+	// Fail fast if the default role is misconfigured, rather than when the first user
+	// tries to register.
+	exists, err := models.Roles.Exists(cfg.defaultRole)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	if !exists {
+		logger.PrintFatal(fmt.Errorf("default role %q does not exist", cfg.defaultRole), nil)
+	}
+
 	// Creating custom metrics
 	expvar.NewString("version").Set(version)
 
@@ -141,10 +294,12 @@ func main() {
 	}))
 
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:        cfg,
+		logger:        logger,
+		models:        models,
+		mailer:        mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		jwtKeys:       jwtKeys,
+		oidcProviders: oidcProviders,
 	}
 
 	err = app.serve()
@@ -189,3 +344,56 @@ func openDB(cfg config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// openPasswordHasher returns the hasher which new password hashes are created with
+func openPasswordHasher(cfg config) (data.Hasher, error) {
+	switch cfg.password.hasher {
+	case "bcrypt":
+		if cfg.password.bcryptCost < bcrypt.MinCost || cfg.password.bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return data.BcryptHasher{Cost: cfg.password.bcryptCost}, nil
+	case "argon2id":
+		if cfg.password.argon2Memory < 8*cfg.password.argon2Parallelism || cfg.password.argon2Memory > math.MaxUint32 {
+			return nil, errors.New("argon2 memory must be at least 8 KiB per thread")
+		}
+		if cfg.password.argon2Iterations < 1 || cfg.password.argon2Iterations > math.MaxUint32 {
+			return nil, errors.New("argon2 iterations must be at least 1")
+		}
+		if cfg.password.argon2Parallelism < 1 || cfg.password.argon2Parallelism > math.MaxUint8 {
+			return nil, fmt.Errorf("argon2 parallelism must be between 1 and %d", math.MaxUint8)
+		}
+		return data.Argon2idHasher{
+			Memory:      uint32(cfg.password.argon2Memory),
+			Iterations:  uint32(cfg.password.argon2Iterations),
+			Parallelism: uint8(cfg.password.argon2Parallelism),
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid password hasher %q", cfg.password.hasher)
+	}
+}
+
+// openJWTKeySet returns the set of keys used to sign and verify JWT access tokens
+func openJWTKeySet(cfg config) (*jwt.KeySet, error) {
+	if len(cfg.auth.jwtKeys) == 0 {
+		return nil, errors.New("at least one JWT key must be provided in jwt auth mode")
+	}
+
+	keys := make([]jwt.Key, len(cfg.auth.jwtKeys))
+
+	for i, spec := range cfg.auth.jwtKeys {
+		key, err := jwt.ParseKey(spec)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+
+	// Unless told otherwise, sign new tokens with the first key.
+	signingKey := cfg.auth.jwtSigningKey
+	if signingKey == "" {
+		signingKey = keys[0].ID
+	}
+
+	return jwt.NewKeySet(signingKey, keys...)
+}
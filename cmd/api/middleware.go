@@ -161,17 +161,94 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		// Otherwise, we expect the value of the Authorization header to be in the format
-		// "Bearer <token>". We try to split this into its constituent parts, and if the
-		// header isn't in the expected format we return a 401 Unauthorized response
+		// "Bearer <token>" or "ApiKey <key>". We try to split this into its constituent
+		// parts, and if the header isn't in the expected format we return a 401
+		// Unauthorized response
 		headerParts := strings.Split(authorizationHeader, " ")
-		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		if len(headerParts) != 2 || (headerParts[0] != "Bearer" && headerParts[0] != "ApiKey") {
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
 
+		// API keys are looked up in their own table. A request made with an API key may
+		// only use the permissions that the key was scoped to, and only as long as the
+		// user still has them, so we put the intersection of the two in the context for
+		// requirePermission to check against.
+		if headerParts[0] == "ApiKey" {
+			v := validator.New()
+
+			if data.ValidateAPIKeyPlaintext(v, headerParts[1]); !v.Valid() {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			apiKey, err := app.models.APIKeys.GetForPlaintext(headerParts[1])
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			user, err := app.models.Users.Get(apiKey.UserID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			app.background(func() {
+				err := app.models.APIKeys.Touch(apiKey.ID)
+				if err != nil {
+					app.logger.PrintError(err, nil)
+				}
+			})
+
+			r = app.contextSetUser(r, user)
+			r = app.contextSetAPIKey(r, apiKey)
+			r = app.contextSetPermissions(r, apiKey.Permissions.Intersect(permissions))
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Extract the actual authentication token from the header parts
 		token := headerParts[1]
 
+		// In JWT mode the token carries everything we need to know about the user, so
+		// we can authenticate the request without a database round trip. The trade-off
+		// is that a JWT stays valid until it expires, even after the user logs out.
+		// Note that the user in the request context only has its ID and Activated
+		// fields set, so handlers which need more should fetch the full record.
+		if app.isJWT(token) {
+			claims, err := app.verifyAccessJWT(token)
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			userID, err := claims.userID()
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			r = app.contextSetUser(r, &data.User{ID: userID, Activated: claims.Activated})
+			r = app.contextSetToken(r, token)
+			r = app.contextSetPermissions(r, claims.Permissions)
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Validate the token to make sure it is in a sensible format
 		v := validator.New()
 
@@ -181,6 +258,8 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		// Retrieve the details of the user associated with the authentication token.
+		// Because the lookup always goes to the tokens table, a token which has been
+		// revoked is rejected on the very next request.
 		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
 		if err != nil {
 			switch {
@@ -192,8 +271,20 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		// add the user information to the request context.
+		// Update the session's last used time in the background so that it doesn't
+		// delay the response. Touch() only writes to the database when the stored
+		// value is stale, so this is cheap for clients making lots of requests.
+		app.background(func() {
+			err := app.models.Tokens.Touch(data.ScopeAuthentication, token)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+
+		// add the user information and the token itself to the request context. The
+		// token is needed by handlers which revoke the current session.
 		r = app.contextSetUser(r, user)
+		r = app.contextSetToken(r, token)
 
 		// call the next handler in the chain
 		next.ServeHTTP(w, r)
@@ -215,6 +306,24 @@ func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.Han
 	})
 }
 
+// requireSession middleware is used to make sure that the client is authenticated with
+// a session token rather than an API key. Managing sessions and API keys can only be
+// done by the user themselves, never by a machine client. The same goes for writing the
+// user's own data, such as their reviews, watchlist and history, which API keys with
+// only movies:read could otherwise do.
+func (app *application) requireSession(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := app.contextGetAPIKey(r); ok {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	return app.requireAuthenticatedUser(fn)
+}
+
 // requireActivatedUser middleware is used to make sure that the client is authenticated
 // and activated
 func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
@@ -239,10 +348,17 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
 
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
-		if err != nil {
-			app.serverErrorResponse(w, r, err)
-			return
+		// Use the permissions from the request context if the authenticate middleware
+		// already knows them, otherwise look them up.
+		permissions, ok := app.contextGetPermissions(r)
+		if !ok {
+			var err error
+
+			permissions, err = app.models.Permissions.GetAllForUser(user.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
 		}
 
 		if !permissions.Include(code) {
@@ -293,6 +409,8 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 			for i := range app.config.cors.trustedOrigins {
 				if origin == app.config.cors.trustedOrigins[i] {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
+					// Let scripts read the ETag header, so that they can make conditional requests
+					w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 					// Check if the request has the HTTP method OPTIONS and contains the
 					// "Access-Control-Request-Method" header. If it does, then we treat
@@ -300,7 +418,7 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 						// Set the necessary preflight response headers
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match")
 						w.WriteHeader(http.StatusOK)
 						return
 					}
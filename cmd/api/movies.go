@@ -25,21 +25,29 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	genres, unknownGenres, err := app.models.Genres.Normalize(input.Genres)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	movie := &data.Movie{
 		Title:   input.Title,
 		Year:    input.Year,
 		Runtime: input.Runtime,
-		Genres:  input.Genres,
+		Genres:  genres,
 	}
 
 	v := validator.New()
 
+	data.ValidateGenres(v, unknownGenres)
+
 	if data.ValidateMovie(v, movie); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Insert(movie)
+	err = app.models.Movies.Insert(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -56,7 +64,8 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
-// showMovieHandler for the "GET /v1/movies/:id" endpoint.
+// showMovieHandler for the "GET /v1/movies/:id" endpoint. The movie's cast and crew
+// are included when the client passes "?include=credits".
 func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request) {
 
 	id, err := app.readIDParam(r)
@@ -65,6 +74,19 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	v := validator.New()
+
+	include := app.readCSV(r.URL.Query(), "include", []string{})
+
+	for _, value := range include {
+		v.Check(validator.In(value, "credits"), "include", "must only contain credits")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	movie, err := app.models.Movies.Get(id)
 	if err != nil {
 		switch {
@@ -76,7 +98,35 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	// The tag only covers the movie's own fields, which are the ones that bump its
+	// version. The rating and votes, which change with every review, the credits and
+	// the per-user in_watchlist aren't part of it, so that every client can use the
+	// same tag with If-Match.
+	etag := versionETag(movie.Version)
+
+	if notModified(r, etag) {
+		app.writeNotModified(w, etag)
+		return
+	}
+
+	if validator.In("credits", include...) {
+		movie.Credits, err = app.models.Credits.GetAllForMovie(movie.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.setInWatchlist(r, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -101,6 +151,14 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Clients which send If-Match get a 412 if the movie has changed since they fetched
+	// it. The version check in Update() still catches changes made while the request is
+	// being handled.
+	if !ifMatch(r, versionETag(movie.Version)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
 	var input struct {
 		Title   *string  `json:"title"`
 		Year    *int32   `json:"year"`
@@ -132,34 +190,54 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		movie.Runtime = *input.Runtime
 	}
 
+	v := validator.New()
+
+	// Genres are stored as the slugs of the genres in our taxonomy, whatever form the
+	// client sent them in.
 	if input.Genres != nil {
-		movie.Genres = input.Genres
-	}
+		genres, unknownGenres, err := app.models.Genres.Normalize(input.Genres)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 
-	v := validator.New()
+		data.ValidateGenres(v, unknownGenres)
+		movie.Genres = genres
+	}
 
 	if data.ValidateMovie(v, movie); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Update(movie)
+	err = app.models.Movies.Update(movie, app.contextGetUser(r).ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
-			app.editConflictResponse(w, r)
+			app.versionConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	err = app.setInWatchlist(r, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", versionETag(movie.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// deleteMovieHandler for the "DELETE /v1/movies/:id" endpoint. The movie is moved to the
+// trash, from where it can be restored until it is purged.
 func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParam(r)
 	if err != nil {
@@ -167,7 +245,7 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Delete(id)
+	movie, err := app.models.Movies.Get(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -178,7 +256,25 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
+	if !ifMatch(r, versionETag(movie.Version)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	// Only the version which was checked above is deleted, in case the movie is changed
+	// in the meantime.
+	err = app.models.Movies.Delete(id, movie.Version, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.versionConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully moved to the trash"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -187,8 +283,10 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 // listMovieHandler for the "GET /v1/movies" endpoint.
 func (app *application) listMovieHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title  string
-		Genres []string
+		Title     string
+		Genres    []string
+		MinRating float64
+		PersonID  int
 		data.Filters
 	}
 
@@ -198,24 +296,61 @@ func (app *application) listMovieHandler(w http.ResponseWriter, r *http.Request)
 
 	input.Title = app.readString(qs, "title", "")
 	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.MinRating = app.readFloat(qs, "min_rating", 0, v)
+	input.PersonID = app.readInt(qs, "person_id", 0, v)
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title",
-		"-year", "-runtime"}
+	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "rating", "votes", "-id", "-title",
+		"-year", "-runtime", "-rating", "-votes"}
+
+	v.Check(input.MinRating >= 0 && input.MinRating <= 10, "min_rating", "must be between 0 and 10")
+	v.Check(input.PersonID >= 0, "person_id", "must not be negative")
+
+	genres, unknownGenres, err := app.models.Genres.Normalize(input.Genres)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	input.Genres = genres
+
+	data.ValidateGenres(v, unknownGenres)
 
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.MinRating, int64(input.PersonID), input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "movies": movies}, nil)
+	err = app.setInWatchlist(r, movies...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"metadata": metadata, "movies": movies}
+
+	etag, err := hashETag(env)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if notModified(r, etag) {
+		app.writeNotModified(w, etag)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	err = app.writeJSON(w, http.StatusOK, env, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
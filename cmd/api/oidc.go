@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hafizmfadli/go-movie/internal/data"
+	"github.com/hafizmfadli/go-movie/internal/oidc"
+	"github.com/hafizmfadli/go-movie/internal/validator"
+)
+
+var (
+	// errUnverifiedEmail is returned by provisionUser when the identity provider hasn't
+	// verified the email address which the new user would get.
+	errUnverifiedEmail = errors.New("identity provider email address is not verified")
+	// errInvitationRequired is returned by provisionUser in invite-only mode when no
+	// invitation was given.
+	errInvitationRequired = errors.New("invitation required")
+	// errInvalidInvitation is returned by provisionUser when the invitation doesn't
+	// exist, has expired, or was sent to a different email address.
+	errInvalidInvitation = errors.New("invalid invitation")
+	// errInvalidOIDCCode is returned by exchangeOIDCCode when the provider rejects the
+	// code.
+	errInvalidOIDCCode = errors.New("invalid authorization code")
+)
+
+// openOIDCProviders returns the OpenID Connect providers configured in the JSON file at
+// cfg.oidc.providersFile, keyed by name. The file holds an array of oidc.Config objects.
+func openOIDCProviders(cfg config) (map[string]*oidc.Provider, error) {
+	providers := make(map[string]*oidc.Provider)
+
+	if cfg.oidc.providersFile == "" {
+		return providers, nil
+	}
+
+	b, err := os.ReadFile(cfg.oidc.providersFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []oidc.Config
+
+	err = json.Unmarshal(b, &configs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OIDC providers file: %w", err)
+	}
+
+	for _, c := range configs {
+		if _, exists := providers[c.Name]; exists {
+			return nil, fmt.Errorf("duplicate OIDC provider %q", c.Name)
+		}
+
+		p, err := oidc.NewProvider(c, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		providers[c.Name] = p
+	}
+
+	return providers, nil
+}
+
+// createOIDCAuthorizationHandler for the "POST /v1/tokens/oidc/:provider" endpoint. It
+// starts an authorization code flow with PKCE, and returns the URL which the client
+// must send the user to. The provider then redirects the user back to the client with
+// a code and a state, which the client passes on to the callback endpoint.
+func (app *application) createOIDCAuthorizationHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[httprouter.ParamsFromContext(r.Context()).ByName("provider")]
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	codeVerifier, err := oidc.RandomString()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	state, err := app.models.OIDCStates.New(provider.Name(), nonce, codeVerifier, 10*time.Minute)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	authorizationURL, err := provider.AuthCodeURL(r.Context(), state.Plaintext, nonce, codeVerifier)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"authorization_url": authorizationURL}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createOIDCAuthenticationTokenHandler for the "POST /v1/tokens/oidc/:provider/callback"
+// endpoint. It exchanges the code from the provider for an ID token, and logs in the
+// user linked to that identity. Users logging in for the first time get a new, activated
+// account, which needs an invitation in invite-only mode. Existing users are never linked
+// to an identity just because the email addresses match; they have to log in and link it
+// themselves with the "POST /v1/users/me/identities/:provider" endpoint.
+func (app *application) createOIDCAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[httprouter.ParamsFromContext(r.Context()).ByName("provider")]
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Code        string `json:"code"`
+		State       string `json:"state"`
+		InviteToken string `json:"invite_token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if validateOIDCCallback(v, input.Code, input.State); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	claims, err := app.exchangeOIDCCode(r, provider, input.Code, input.State)
+	if err != nil {
+		app.oidcExchangeErrorResponse(w, r, v, err)
+		return
+	}
+
+	var user *data.User
+
+	identity, err := app.models.Identities.Get(provider.Name(), claims.Subject)
+	switch {
+	case err == nil:
+		user, err = app.models.Users.Get(identity.UserID)
+	case errors.Is(err, data.ErrRecordNotFound):
+		user, err = app.provisionUser(provider.Name(), claims, input.InviteToken)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnverifiedEmail):
+			app.errorResponse(w, r, http.StatusForbidden, "your identity provider account must have a verified email address")
+		case errors.Is(err, data.ErrDuplicateEmail):
+			message := "a user with this email address already exists, log in and link your identity provider account instead"
+			app.errorResponse(w, r, http.StatusConflict, message)
+		case errors.Is(err, errInvitationRequired):
+			v.AddError("invite_token", "must be provided")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, errInvalidInvitation):
+			v.AddError("invite_token", "invalid or expired invitation")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Users provisioned here are activated straight away, so an inactive user is one
+	// who hasn't activated their account yet, or who was deactivated by an admin.
+	// Neither may log in through the identity provider.
+	if !user.Activated {
+		app.inactiveAccountResponse(w, r)
+		return
+	}
+
+	// The identity provider replaces the password, not the second factor.
+	t, err := app.models.TOTP.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if t != nil && t.Enabled {
+		token, err := app.models.Tokens.New(user.ID, 5*time.Minute, data.ScopeTwoFactorPending)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusCreated, envelope{"two_factor_token": token}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	accessToken, refreshToken, err := app.createSessionTokens(r, user, 0)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"authentication_token": accessToken, "refresh_token": refreshToken}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// linkOIDCIdentityHandler for the "POST /v1/users/me/identities/:provider" endpoint. It
+// links an identity provider account to the current user, so that they can log in
+// through the provider from then on. The flow is started with the same authorization
+// endpoint as logins, and the code and state are sent here instead of to the callback.
+func (app *application) linkOIDCIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[httprouter.ParamsFromContext(r.Context()).ByName("provider")]
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if validateOIDCCallback(v, input.Code, input.State); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	claims, err := app.exchangeOIDCCode(r, provider, input.Code, input.State)
+	if err != nil {
+		app.oidcExchangeErrorResponse(w, r, v, err)
+		return
+	}
+
+	identity := &data.Identity{
+		Provider: provider.Name(),
+		Subject:  claims.Subject,
+		UserID:   app.contextGetUser(r).ID,
+		Email:    claims.Email,
+	}
+
+	err = app.models.Identities.Insert(identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateIdentity):
+			v.AddError("code", "this identity provider account is already linked to a user")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"identity": identity}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func validateOIDCCallback(v *validator.Validator, code, state string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(state != "", "state", "must be provided")
+}
+
+// exchangeOIDCCode consumes the state which was created when the flow started, and
+// exchanges the code for the claims about the user's identity at the provider. It
+// returns data.ErrRecordNotFound if the state is invalid or has expired, and an error
+// wrapping errInvalidOIDCCode if the provider rejects the code.
+func (app *application) exchangeOIDCCode(r *http.Request, provider *oidc.Provider, code, statePlaintext string) (*oidc.Claims, error) {
+	state, err := app.models.OIDCStates.Consume(provider.Name(), statePlaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := provider.Exchange(r.Context(), code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidOIDCCode, err)
+	}
+
+	return claims, nil
+}
+
+// oidcExchangeErrorResponse sends the response for an error from exchangeOIDCCode.
+func (app *application) oidcExchangeErrorResponse(w http.ResponseWriter, r *http.Request, v *validator.Validator, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		v.AddError("state", "invalid or expired state")
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, errInvalidOIDCCode):
+		// The provider rejecting the code is the client's fault, but we log it anyway
+		// because it's also what a misconfigured provider looks like.
+		app.logError(r, err)
+		app.invalidCredentialsResponse(w, r)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// provisionUser creates a new, activated user for an identity provider account, and
+// links the identity to them. The provider must have verified the email address, and
+// no user may have it already. Like registration, an invitation is needed in
+// invite-only mode, and if one is given it decides the user's permissions instead of
+// the default role. The user gets a random password which is never shown to anybody,
+// so they can only log in through the provider until they reset it.
+func (app *application) provisionUser(providerName string, claims *oidc.Claims, inviteToken string) (*data.User, error) {
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errUnverifiedEmail
+	}
+
+	// Checked up front, so that existing users are told to link their account rather
+	// than asked for an invitation.
+	_, err := app.models.Users.GetByEmail(claims.Email)
+	switch {
+	case err == nil:
+		return nil, data.ErrDuplicateEmail
+	case !errors.Is(err, data.ErrRecordNotFound):
+		return nil, err
+	}
+
+	var invitation *data.Invitation
+
+	if app.config.inviteOnly || inviteToken != "" {
+		if inviteToken == "" {
+			return nil, errInvitationRequired
+		}
+
+		invitation, err = app.models.Invitations.GetForPlaintext(inviteToken)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				return nil, errInvalidInvitation
+			default:
+				return nil, err
+			}
+		}
+
+		if !strings.EqualFold(invitation.Email, claims.Email) {
+			return nil, errInvalidInvitation
+		}
+	}
+
+	user := &data.User{
+		Name:      claims.Name,
+		Email:     claims.Email,
+		Activated: true,
+	}
+
+	if user.Name == "" {
+		user.Name = claims.Email
+	}
+
+	password, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	err = user.Password.Set(password)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.models.Users.Insert(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if invitation != nil {
+		err = app.models.Invitations.Accept(invitation.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		err = app.models.Permissions.AddForUser(user.ID, invitation.Permissions...)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err = app.models.Roles.AddForUser(user.ID, app.config.defaultRole)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	identity := &data.Identity{
+		Provider: providerName,
+		Subject:  claims.Subject,
+		UserID:   user.ID,
+		Email:    claims.Email,
+	}
+
+	err = app.models.Identities.Insert(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -19,15 +19,81 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.routeTrash(app.requirePermission("movies:read", app.showMovieHandler), app.requirePermission("movies:write", app.listTrashHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.requirePermission("movies:write", app.restoreMovieHandler))
 	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMovieHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/genres", app.requirePermission("movies:read", app.listGenresHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/reviews", app.requireSession(app.requirePermission("movies:read", app.createReviewHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews", app.requirePermission("movies:read", app.listReviewsHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id/reviews", app.requireSession(app.requirePermission("movies:read", app.updateReviewHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/reviews", app.requireSession(app.requirePermission("movies:read", app.deleteReviewHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/credits", app.requirePermission("movies:read", app.listCreditsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/credits", app.requirePermission("movies:write", app.createCreditHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/credits/:credit_id", app.requirePermission("movies:write", app.deleteCreditHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions", app.requirePermission("movies:read", app.listRevisionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revisions/:version/revert", app.requirePermission("movies:write", app.revertMovieHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/people", app.requirePermission("movies:write", app.createPersonHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id", app.requirePermission("movies:read", app.showPersonHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/people/:id", app.requirePermission("movies:write", app.updatePersonHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/people/:id", app.requirePermission("movies:write", app.deletePersonHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/people", app.requirePermission("movies:read", app.listPeopleHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", app.requireAuthenticatedUser(app.showCurrentUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.requireSession(app.updateCurrentUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.requireSession(app.deleteCurrentUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/deletion", app.requireSession(app.cancelCurrentUserDeletionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/export", app.requireSession(app.exportCurrentUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/email", app.updateCurrentUserEmailHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/password", app.requireSession(app.updateCurrentUserPasswordHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/sessions", app.requireSession(app.listSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions/:id", app.requireSession(app.deleteSessionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/totp", app.requireSession(app.createTOTPHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/totp/confirmed", app.requireSession(app.confirmTOTPHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/totp", app.requireSession(app.deleteTOTPHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/api-keys", app.requireSession(app.createAPIKeyHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/api-keys", app.requireSession(app.listAPIKeysHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/api-keys/:id", app.requireSession(app.deleteAPIKeyHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/identities/:provider", app.requireSession(app.linkOIDCIdentityHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/watchlist", app.requirePermission("movies:read", app.listWatchlistHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/watchlist", app.requireSession(app.requirePermission("movies:read", app.addToWatchlistHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/watchlist/:id", app.requireSession(app.requirePermission("movies:read", app.removeFromWatchlistHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/history", app.requirePermission("movies:read", app.listHistoryHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/history", app.requireSession(app.requirePermission("movies:read", app.createHistoryEntryHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/history/:id", app.requireSession(app.requirePermission("movies:read", app.deleteHistoryEntryHandler)))
 
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication", app.requireSession(app.deleteAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication/all", app.requireSession(app.deleteAllAuthenticationTokensHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/2fa", app.createTwoFactorAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.createRefreshTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/magic-link", app.createMagicLinkTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/magic-link/exchange", app.exchangeMagicLinkTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/oidc/:provider", app.createOIDCAuthorizationHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/oidc/:provider/callback", app.createOIDCAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users", app.requirePermission("users:admin", app.listUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id", app.requirePermission("users:admin", app.showUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/activated", app.requirePermission("users:admin", app.updateUserActivatedHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.addUserPermissionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/permissions/:code", app.requirePermission("users:admin", app.removeUserPermissionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/tokens", app.requirePermission("users:admin", app.deleteUserTokensHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/roles", app.requirePermission("users:admin", app.listRolesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/roles", app.requirePermission("users:admin", app.addUserRolesHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles/:role", app.requirePermission("users:admin", app.removeUserRoleHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/invitations", app.requirePermission("users:admin", app.createInvitationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/invitations", app.requirePermission("users:admin", app.listInvitationsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/invitations/:id", app.requirePermission("users:admin", app.deleteInvitationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/login-failures", app.requirePermission("users:admin", app.listLoginFailuresHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/login-failures", app.requirePermission("users:admin", app.deleteLoginFailuresHandler))
 
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
@@ -25,6 +25,14 @@ func (app *application) serve() error {
 	// by the graceful Shutdown() function
 	shutdownError := make(chan error)
 
+	// stopJobs is used to tell the periodic background jobs to finish when the server
+	// shuts down.
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	app.runDeletionJob(jobsCtx)
+	app.runPurgeJob(jobsCtx)
+
 	go func() {
 		// quit channel carries os.Signal values
 		quit := make(chan os.Signal, 1)
@@ -58,6 +66,7 @@ func (app *application) serve() error {
 		})
 
 		// Blocking until the background goroutines have finished.
+		stopJobs()
 		app.wg.Wait()
 		shutdownError <- nil
 	}()
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/hafizmfadli/go-movie/internal/data"
+)
+
+// listSessionsHandler for the "GET /v1/users/me/sessions" endpoint. A session is an
+// unused and unexpired refresh token, together with the device metadata which was
+// recorded when it was issued. Note that the session ID changes each time the refresh
+// token is rotated.
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	sessions, err := app.models.Tokens.GetAllForUser(data.ScopeRefresh, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteSessionHandler for the "DELETE /v1/users/me/sessions/:id" endpoint.
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	// Scoping the delete to the current user means that a session belonging to
+	// somebody else looks exactly the same as one that doesn't exist. Deleting the
+	// refresh token also deletes the access tokens which were issued from it.
+	err = app.models.Tokens.DeleteForUser(data.ScopeRefresh, user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "session successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/hafizmfadli/go-movie/internal/data"
 	"github.com/hafizmfadli/go-movie/internal/validator"
+	"github.com/tomasen/realip"
 )
 
 // createAuthenticationTokenHandler for the "POST /v1/tokens/authentication" endpoint.
@@ -31,10 +32,28 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
+	// Refuse to check the password at all while the account or the client IP address
+	// is locked out or backing off after failed attempts.
+	retryAfter, err := app.loginRetryAfter(r, input.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		app.loginThrottledResponse(w, r, retryAfter)
+		return
+	}
+
 	user, err := app.models.Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
+			err = app.recordLoginFailure(r, input.Email, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
 			app.invalidCredentialsResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
@@ -49,17 +68,473 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	}
 
 	if !match {
+		err = app.recordLoginFailure(r, input.Email, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	// Matches() upgrades the password hash if it was created with an outdated algorithm
+	// or parameters. Failing to save it isn't a reason to fail the login, because we can
+	// try again next time.
+	err = app.models.Users.UpdatePasswordHash(user)
+	if err != nil {
+		app.logError(r, err)
+	}
+
+	// If the user has two-factor authentication enabled, the password alone isn't
+	// enough. Instead of the authentication token we send a short-lived token which
+	// must be exchanged, together with a valid code, at "POST /v1/tokens/2fa".
+	t, err := app.models.TOTP.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if t != nil && t.Enabled {
+		token, err := app.models.Tokens.New(user.ID, 5*time.Minute, data.ScopeTwoFactorPending)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusCreated, envelope{"two_factor_token": token}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.resetLoginFailures(user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	accessToken, refreshToken, err := app.createSessionTokens(r, user, 0)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"authentication_token": accessToken, "refresh_token": refreshToken}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createTwoFactorAuthenticationTokenHandler for the "POST /v1/tokens/2fa" endpoint. It
+// is the second login step for users with two-factor authentication enabled, and
+// exchanges a 2fa-pending token plus either a TOTP code or a recovery code for an
+// authentication token.
+func (app *application) createTwoFactorAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+
+	switch {
+	case input.Code != "" && input.RecoveryCode != "":
+		v.AddError("code", "must not be provided together with recovery_code")
+	case input.RecoveryCode != "":
+		data.ValidateRecoveryCode(v, input.RecoveryCode)
+	default:
+		data.ValidateTOTPCode(v, input.Code)
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeTwoFactorPending, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired two-factor token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Wrong codes count as failed login attempts too, otherwise the pending token
+	// could be used to guess codes without limit.
+	retryAfter, err := app.loginRetryAfter(r, user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		app.loginThrottledResponse(w, r, retryAfter)
+		return
+	}
+
+	valid := true
+
+	if input.RecoveryCode != "" {
+		err = app.models.RecoveryCodes.Consume(user.ID, input.RecoveryCode)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				valid = false
+			default:
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+	} else {
+		t, err := app.models.TOTP.Get(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		valid = app.checkTOTPCode(t, input.Code)
+	}
+
+	if !valid {
+		err = app.recordLoginFailure(r, user.Email, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 		app.invalidCredentialsResponse(w, r)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	err = app.resetLoginFailures(user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeTwoFactorPending, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	accessToken, refreshToken, err := app.createSessionTokens(r, user, 0)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"authentication_token": accessToken, "refresh_token": refreshToken}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createRefreshTokenHandler for the "POST /v1/tokens/refresh" endpoint. It exchanges a
+// refresh token for a new access token and a new refresh token. Each refresh token can
+// only be used once.
+func (app *application) createRefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	token, err := app.models.Tokens.Consume(data.ScopeRefresh, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired refresh token")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrTokenReused):
+			// By this point Consume() has already revoked the whole token family, so
+			// whoever holds the stolen tokens has been logged out. We log it and give
+			// the client the same response as for any other invalid token.
+			app.logger.PrintInfo("refresh token reused, token family revoked", map[string]string{
+				"client_ip": realip.FromRequest(r),
+			})
+			v.AddError("token", "invalid or expired refresh token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.models.Users.Get(token.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	accessToken, refreshToken, err := app.createSessionTokens(r, user, token.FamilyID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"authentication_token": accessToken, "refresh_token": refreshToken}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createSessionTokens issues a short-lived access token (in the authentication scope)
+// and a long-lived refresh token for a user. Both tokens belong to the given token
+// family, or to a brand new family if familyID is 0. We also record which device the
+// tokens were issued to, so that the user can recognise the session later.
+//
+// In JWT mode the access token is a signed JWT, but the refresh token is still stored
+// in the database so that sessions can be listed and revoked.
+func (app *application) createSessionTokens(r *http.Request, user *data.User, familyID int64) (*data.Token, *data.Token, error) {
+	var err error
+
+	if familyID == 0 {
+		familyID, err = app.models.Tokens.NewFamily()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	userAgent := r.UserAgent()
+	clientIP := realip.FromRequest(r)
+
+	var accessToken *data.Token
+
+	if app.jwtKeys != nil {
+		accessToken, err = app.createAccessJWT(user, familyID, 15*time.Minute)
+	} else {
+		accessToken, err = app.models.Tokens.NewSession(user.ID, 15*time.Minute, data.ScopeAuthentication, familyID, userAgent, clientIP)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refreshToken, err := app.models.Tokens.NewSession(user.ID, 30*24*time.Hour, data.ScopeRefresh, familyID, userAgent, clientIP)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// createPasswordResetTokenHandler for the "POST /v1/tokens/password-reset" endpoint.
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// We always send the same response, whether or not the email address belongs
+	// to a user. Otherwise this endpoint could be used to find out which email
+	// addresses are registered with us.
+	env := envelope{"message": "if the email address is registered, an email will be sent to you containing password reset instructions"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			err = app.writeJSON(w, http.StatusAccepted, env, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		data := map[string]interface{}{
+			"passwordResetToken": token.Plaintext,
+		}
+
+		err := app.mailer.Send(user.Email, "token_password_reset.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createActivationTokenHandler for the "POST /v1/tokens/activation" endpoint.
+func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Like the password reset endpoint, the response is the same for unknown email
+	// addresses and for accounts which are already activated, so that it can't be
+	// used to find out which email addresses are registered with us.
+	env := envelope{"message": "if the email address belongs to an account awaiting activation, an email will be sent to you containing activation instructions"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if user != nil && !user.Activated {
+		// Only the most recent activation token should be usable, so delete any
+		// tokens that were sent before.
+		err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.background(func() {
+			data := map[string]interface{}{
+				"activationToken": token.Plaintext,
+			}
+
+			err := app.mailer.Send(user.Email, "token_activation.tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAuthenticationTokenHandler for the "DELETE /v1/tokens/authentication" endpoint.
+// It revokes the authentication token which was used to make the request, together
+// with the refresh token it was issued alongside.
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	token := app.contextGetToken(r)
+
+	// A JWT can't be revoked, so instead we delete the refresh token it was issued
+	// alongside. The JWT itself stops working when it expires shortly afterwards.
+	if app.isJWT(token) {
+		claims, err := app.verifyAccessJWT(token)
+		if err != nil {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		err = app.models.Tokens.DeleteFamily(claims.FamilyID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been successfully logged out"}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err := app.models.Tokens.Delete(data.ScopeAuthentication, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been successfully logged out"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAllAuthenticationTokensHandler for the "DELETE /v1/tokens/authentication/all"
+// endpoint. It revokes every authentication token belonging to the current user.
+func (app *application) deleteAllAuthenticationTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.models.Tokens.DeleteAllForUser(data.ScopeAuthentication, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeRefresh, user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been successfully logged out of all sessions"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
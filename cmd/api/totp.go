@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/hafizmfadli/go-movie/internal/data"
+	"github.com/hafizmfadli/go-movie/internal/totp"
+	"github.com/hafizmfadli/go-movie/internal/validator"
+)
+
+// createTOTPHandler for the "POST /v1/users/me/totp" endpoint. It starts enrolling the
+// user in two-factor authentication by generating a new secret. Two-factor
+// authentication isn't enabled until the user confirms the secret with a valid code.
+func (app *application) createTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	t := &data.TOTP{
+		UserID: user.ID,
+		Secret: secret,
+	}
+
+	err = app.models.TOTP.Insert(t)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.errorResponse(w, r, http.StatusConflict, "two-factor authentication is already enabled")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{
+		"totp": map[string]string{
+			"secret": secret,
+			"uri":    totp.URI(app.config.totp.issuer, user.Email, secret),
+		},
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// confirmTOTPHandler for the "PUT /v1/users/me/totp/confirmed" endpoint. It enables
+// two-factor authentication once the user proves that their authenticator app is set
+// up by sending a valid code, and returns a set of single-use recovery codes.
+func (app *application) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTOTPCode(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	t, err := app.models.TOTP.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.errorResponse(w, r, http.StatusConflict, "two-factor authentication enrollment has not been started")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if t.Enabled {
+		app.errorResponse(w, r, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+
+	if !app.checkTOTPCode(t, input.Code) {
+		v.AddError("code", "invalid code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.TOTP.Enable(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	codes, err := app.models.RecoveryCodes.NewForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The recovery codes are included in this response only, so the client must
+	// show them to the user now.
+	env := envelope{
+		"message":        "two-factor authentication successfully enabled",
+		"recovery_codes": codes,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteTOTPHandler for the "DELETE /v1/users/me/totp" endpoint. It turns off
+// two-factor authentication, which requires the user to re-enter their password.
+func (app *application) deleteTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidatePasswordPlaintext(v, input.Password); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	err = app.models.TOTP.Delete(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.RecoveryCodes.DeleteAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "two-factor authentication successfully disabled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkTOTPCode reports whether code is valid for the user's secret right now. Each
+// code is accepted at most once, even though it stays valid for a little while.
+func (app *application) checkTOTPCode(t *data.TOTP, code string) bool {
+	step, ok := totp.Validate(t.Secret, code, time.Now())
+	if !ok {
+		return false
+	}
+
+	err := app.models.TOTP.UseStep(t.UserID, step)
+	if err != nil {
+		if !errors.Is(err, data.ErrEditConflict) {
+			app.logger.PrintError(err, nil)
+		}
+		return false
+	}
+
+	return true
+}
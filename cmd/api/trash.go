@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hafizmfadli/go-movie/internal/data"
+	"github.com/hafizmfadli/go-movie/internal/validator"
+)
+
+// routeTrash sends "GET /v1/movies/trash" to the trash handler, and every other request
+// to next. httprouter doesn't allow a static path segment alongside the :id wildcard,
+// so both have to share the "GET /v1/movies/:id" route.
+func (app *application) routeTrash(next, trash http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if httprouter.ParamsFromContext(r.Context()).ByName("id") == "trash" {
+			trash(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// listTrashHandler for the "GET /v1/movies/trash" endpoint. It lists the deleted movies
+// which haven't been purged yet.
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-deleted_at")
+	input.Filters.SortSafelist = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetAllTrashed(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"metadata":  metadata,
+		"movies":    movies,
+		"retention": app.config.trash.retention.String(),
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreMovieHandler for the "POST /v1/movies/:id/restore" endpoint. It takes a movie
+// out of the trash.
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Movies.Restore(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.setInWatchlist(r, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runPurgeJob starts a background goroutine which periodically purges the movies which
+// have been in the trash for longer than the retention period. It stops when ctx is
+// cancelled.
+func (app *application) runPurgeJob(ctx context.Context) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(app.config.trash.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				app.purgeTrashedMovies()
+			}
+		}
+	}()
+}
+
+// purgeTrashedMovies runs a single pass of the purge job. Panics are recovered so that
+// one bad pass doesn't stop the job for good.
+func (app *application) purgeTrashedMovies() {
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.PrintError(fmt.Errorf("%s", err), nil)
+		}
+	}()
+
+	n, err := app.models.Movies.Purge(time.Now().Add(-app.config.trash.retention))
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	if n > 0 {
+		app.logger.PrintInfo("purged trashed movies", map[string]string{
+			"count": fmt.Sprint(n),
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/hafizmfadli/go-movie/internal/data"
+	"github.com/hafizmfadli/go-movie/internal/validator"
+)
+
+// setInWatchlist sets the InWatchlist flag of each movie, for the user making the
+// request.
+func (app *application) setInWatchlist(r *http.Request, movies ...*data.Movie) error {
+	user := app.contextGetUser(r)
+	if user.IsAnonymous() || len(movies) == 0 {
+		return nil
+	}
+
+	movieIDs := make([]int64, len(movies))
+	for i, movie := range movies {
+		movieIDs[i] = movie.ID
+	}
+
+	contains, err := app.models.Watchlist.Contains(user.ID, movieIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, movie := range movies {
+		inWatchlist := contains[movie.ID]
+		movie.InWatchlist = &inWatchlist
+	}
+
+	return nil
+}
+
+// listWatchlistHandler for the "GET /v1/users/me/watchlist" endpoint.
+func (app *application) listWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-added_at")
+	input.Filters.SortSafelist = []string{"added_at", "title", "year", "rating", "-added_at", "-title",
+		"-year", "-rating"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries, metadata, err := app.models.Watchlist.GetAllForUser(app.contextGetUser(r).ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, entry := range entries {
+		inWatchlist := true
+		entry.Movie.InWatchlist = &inWatchlist
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "watchlist": entries}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// addToWatchlistHandler for the "POST /v1/users/me/watchlist" endpoint.
+func (app *application) addToWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MovieID int64 `json:"movie_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(input.MovieID > 0, "movie_id", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(input.MovieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("movie_id", "movie does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	entry, err := app.models.Watchlist.Add(app.contextGetUser(r).ID, movie.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("movie_id", "movie does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateWatchlistEntry):
+			v.AddError("movie_id", "movie is already on your watchlist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	inWatchlist := true
+	movie.InWatchlist = &inWatchlist
+	entry.Movie = movie
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"watchlist_entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// removeFromWatchlistHandler for the "DELETE /v1/users/me/watchlist/:id" endpoint,
+// where id is the ID of the movie.
+func (app *application) removeFromWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Watchlist.Remove(app.contextGetUser(r).ID, movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully removed from watchlist"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listHistoryHandler for the "GET /v1/users/me/history" endpoint.
+func (app *application) listHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-watched_at")
+	input.Filters.SortSafelist = []string{"watched_at", "title", "year", "rating", "-watched_at", "-title",
+		"-year", "-rating"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries, metadata, err := app.models.History.GetAllForUser(app.contextGetUser(r).ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	movies := make([]*data.Movie, len(entries))
+	for i, entry := range entries {
+		movies[i] = entry.Movie
+	}
+
+	err = app.setInWatchlist(r, movies...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"metadata": metadata, "history": entries}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createHistoryEntryHandler for the "POST /v1/users/me/history" endpoint. It marks a
+// movie as watched, at the given time or now, and takes it off the user's watchlist.
+func (app *application) createHistoryEntryHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MovieID   int64      `json:"movie_id"`
+		WatchedAt *time.Time `json:"watched_at"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	entry := &data.HistoryEntry{
+		UserID:    app.contextGetUser(r).ID,
+		Movie:     &data.Movie{ID: input.MovieID},
+		WatchedAt: time.Now(),
+	}
+
+	if input.WatchedAt != nil {
+		entry.WatchedAt = *input.WatchedAt
+	}
+
+	v := validator.New()
+
+	if data.ValidateHistoryEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entry.Movie, err = app.models.Movies.Get(input.MovieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("movie_id", "movie does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.History.Insert(entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("movie_id", "movie does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	inWatchlist := false
+	entry.Movie.InWatchlist = &inWatchlist
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"history_entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteHistoryEntryHandler for the "DELETE /v1/users/me/history/:id" endpoint.
+func (app *application) deleteHistoryEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.History.DeleteForUser(app.contextGetUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "history entry successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,56 @@
+// Command fakeoidc runs a fake OpenID Connect provider, so that the SSO login flow of
+// the API can be tried out locally. Every authorization request is approved straight
+// away for the user given on the command line.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/hafizmfadli/go-movie/internal/jsonlog"
+	"github.com/hafizmfadli/go-movie/internal/oidc/oidctest"
+)
+
+func main() {
+	var (
+		port         int
+		clientID     string
+		clientSecret string
+		subject      string
+		email        string
+		name         string
+	)
+
+	flag.IntVar(&port, "port", 4010, "Fake provider port")
+	flag.StringVar(&clientID, "client-id", "netflix", "OAuth 2.0 client ID")
+	flag.StringVar(&clientSecret, "client-secret", "pa55word", "OAuth 2.0 client secret")
+	flag.StringVar(&subject, "subject", "1234567890", "Subject of the logged in user")
+	flag.StringVar(&email, "email", "alice@example.com", "Email address of the logged in user")
+	flag.StringVar(&name, "name", "Alice Smith", "Name of the logged in user")
+	flag.Parse()
+
+	logger := jsonlog.NewLogger(os.Stdout, jsonlog.LevelInfo)
+
+	issuer := fmt.Sprintf("http://localhost:%d", port)
+
+	p, err := oidctest.NewProvider(issuer, clientID, clientSecret)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	p.Subject = subject
+	p.Email = email
+	p.Name = name
+
+	logger.PrintInfo("starting fake OpenID Connect provider", map[string]string{
+		"issuer":    issuer,
+		"client_id": clientID,
+	})
+
+	err = http.ListenAndServe(fmt.Sprintf(":%d", port), p)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+}
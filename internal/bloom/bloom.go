@@ -0,0 +1,104 @@
+// Package bloom implements a Bloom filter of strings, with a compact binary format so
+// that filters can be built ahead of time and embedded in the binary.
+package bloom
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// magic identifies the file format written by Filter.WriteTo.
+const magic = "BLM1"
+
+// Filter is a Bloom filter of strings. It can tell that a string is definitely not in
+// the set it was built from, but only that a string is probably in it. In exchange,
+// it is far smaller than the set itself.
+type Filter struct {
+	k    uint32
+	bits []byte
+}
+
+// New returns an empty Filter sized to hold n strings with the given false
+// positive rate.
+func New(n int, falsePositiveRate float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+
+	m := math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(n) * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+
+	return &Filter{k: uint32(k), bits: make([]byte, int(math.Ceil(m/8)))}
+}
+
+// Read reads a Filter in the format written by WriteTo.
+func Read(b []byte) (*Filter, error) {
+	if len(b) < len(magic)+4 || string(b[:len(magic)]) != magic {
+		return nil, errors.New("bloom: invalid filter")
+	}
+
+	b = b[len(magic):]
+
+	f := &Filter{k: binary.BigEndian.Uint32(b), bits: b[4:]}
+	if f.k == 0 || len(f.bits) == 0 {
+		return nil, errors.New("bloom: invalid filter")
+	}
+
+	return f, nil
+}
+
+// WriteTo writes the filter as the magic bytes "BLM1", the number of hash functions
+// as a big-endian uint32, and the bits.
+func (f *Filter) WriteTo(w io.Writer) (int64, error) {
+	header := make([]byte, len(magic)+4)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[len(magic):], f.k)
+
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+
+	m, err := w.Write(f.bits)
+	return int64(n + m), err
+}
+
+// Add adds s to the filter.
+func (f *Filter) Add(s string) {
+	for _, i := range f.indexes(s) {
+		f.bits[i/8] |= 1 << (i % 8)
+	}
+}
+
+// Contains reports whether s is probably in the filter.
+func (f *Filter) Contains(s string) bool {
+	for _, i := range f.indexes(s) {
+		if f.bits[i/8]&(1<<(i%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// indexes returns the k bit indexes for s. They are derived from two halves of its
+// SHA-256 hash using double hashing, which is as good as k independent hashes.
+func (f *Filter) indexes(s string) []uint64 {
+	sum := sha256.Sum256([]byte(s))
+	h1 := binary.BigEndian.Uint64(sum[0:8])
+	h2 := binary.BigEndian.Uint64(sum[8:16])
+
+	m := uint64(len(f.bits)) * 8
+	indexes := make([]uint64, f.k)
+
+	for i := range indexes {
+		indexes[i] = (h1 + uint64(i)*h2) % m
+	}
+
+	return indexes
+}
@@ -0,0 +1,233 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+
+	"github.com/hafizmfadli/go-movie/internal/validator"
+	"github.com/lib/pq"
+)
+
+// APIKey is a long-lived credential for machine-to-machine clients. Each key is scoped
+// to a subset of the permissions of the user who created it.
+type APIKey struct {
+	ID     int64  `json:"id"`
+	UserID int64  `json:"-"`
+	Name   string `json:"name"`
+	// Prefix is the first few characters of the key. It is safe to show, and lets the
+	// user tell their keys apart.
+	Prefix string `json:"prefix"`
+	// Plaintext is only set when the key is created. It is never stored, so it can't
+	// be shown again.
+	Plaintext   string      `json:"key,omitempty"`
+	Hash        []byte      `json:"-"`
+	Permissions Permissions `json:"permissions"`
+	// Expiry is nil for keys which never expire.
+	Expiry     *time.Time `json:"expiry"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+const apiKeyPrefixLength = 8
+
+func generateAPIKey(userID int64, name string, permissions Permissions, expiry *time.Time) (*APIKey, error) {
+	randomBytes := make([]byte, 32)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+
+	key := &APIKey{
+		UserID:      userID,
+		Name:        name,
+		Prefix:      plaintext[:apiKeyPrefixLength],
+		Plaintext:   plaintext,
+		Hash:        hashToken(plaintext),
+		Permissions: permissions,
+		Expiry:      expiry,
+	}
+
+	return key, nil
+}
+
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(key.Permissions != nil, "permissions", "must be provided")
+	v.Check(len(key.Permissions) >= 1, "permissions", "must contain at least 1 permission")
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate values")
+
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+}
+
+func ValidateAPIKeyPlaintext(v *validator.Validator, keyPlaintext string) {
+	v.Check(keyPlaintext != "", "key", "must be provided")
+	v.Check(len(keyPlaintext) == 52, "key", "must be 52 bytes long")
+}
+
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a new record to the api_keys table and set key.ID and key.CreatedAt
+// using value generated by database
+func (m APIKeyModel) Insert(key *APIKey) error {
+	query := `
+	INSERT INTO api_keys (user_id, name, prefix, hash, permissions, expiry)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at`
+
+	args := []interface{}{key.UserID, key.Name, key.Prefix, key.Hash, pq.Array(key.Permissions), key.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+}
+
+// New is shortcut which creates a new API key and then inserts it in the api_keys table.
+func (m APIKeyModel) New(userID int64, name string, permissions Permissions, expiry *time.Time) (*APIKey, error) {
+	key, err := generateAPIKey(userID, name, permissions, expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(key)
+	return key, err
+}
+
+// GetForPlaintext retrieves the unexpired API key whose hash matches the provided
+// plaintext key.
+func (m APIKeyModel) GetForPlaintext(keyPlaintext string) (*APIKey, error) {
+	query := `
+	SELECT id, user_id, name, prefix, permissions, expiry, created_at, last_used_at
+	FROM api_keys
+	WHERE hash = $1 AND (expiry IS NULL OR expiry > $2)`
+
+	var key APIKey
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hashToken(keyPlaintext), time.Now()).Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Permissions),
+		&key.Expiry,
+		&key.CreatedAt,
+		&key.LastUsedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &key, nil
+}
+
+// GetAllForUser returns all API keys for a specific user, including expired ones.
+func (m APIKeyModel) GetAllForUser(userID int64) ([]*APIKey, error) {
+	query := `
+	SELECT id, user_id, name, prefix, permissions, expiry, created_at, last_used_at
+	FROM api_keys
+	WHERE user_id = $1
+	ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+
+	for rows.Next() {
+		var key APIKey
+
+		err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array(&key.Permissions),
+			&key.Expiry,
+			&key.CreatedAt,
+			&key.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// DeleteForUser deletes the API key with a specific ID and owner.
+func (m APIKeyModel) DeleteForUser(userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM api_keys
+	WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Touch records that an API key has just been used. Like TokenModel.Touch, the row is
+// only written when the stored last_used_at value is more than a minute old.
+func (m APIKeyModel) Touch(id int64) error {
+	query := `
+	UPDATE api_keys
+	SET last_used_at = NOW()
+	WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
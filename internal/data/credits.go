@@ -0,0 +1,199 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/hafizmfadli/go-movie/internal/validator"
+)
+
+var (
+	// ErrDuplicateCredit is returned when a person is credited twice on a movie for the
+	// same role and character.
+	ErrDuplicateCredit = errors.New("duplicate credit")
+)
+
+// CreditRoles are the kinds of work which a person can be credited for.
+var CreditRoles = []string{"actor", "director", "writer", "producer"}
+
+// Credit links a person to a movie they worked on. Credits are listed in billing order.
+type Credit struct {
+	ID       int64 `json:"id"`
+	MovieID  int64 `json:"movie_id"`
+	PersonID int64 `json:"person_id"`
+	// PersonName is set when the credits of a movie are listed, and MovieTitle when the
+	// credits of a person are listed.
+	PersonName   string `json:"person_name,omitempty"`
+	MovieTitle   string `json:"movie_title,omitempty"`
+	Role         string `json:"role"`
+	Character    string `json:"character,omitempty"`
+	BillingOrder int32  `json:"billing_order"`
+}
+
+func ValidateCredit(v *validator.Validator, credit *Credit) {
+	v.Check(credit.PersonID > 0, "person_id", "must be provided")
+	v.Check(credit.Role != "", "role", "must be provided")
+	v.Check(validator.In(credit.Role, CreditRoles...), "role", "must be one of actor, director, writer or producer")
+	v.Check(credit.Character == "" || credit.Role == "actor", "character", "must only be provided for actors")
+	v.Check(len(credit.Character) <= 500, "character", "must not be more than 500 bytes long")
+	v.Check(credit.BillingOrder >= 0, "billing_order", "must not be negative")
+}
+
+type CreditModel struct {
+	DB *sql.DB
+}
+
+// Insert inserts a new record in the credits table.
+func (m CreditModel) Insert(credit *Credit) error {
+	query := `
+	INSERT INTO credits (movie_id, person_id, role, character, billing_order)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id`
+
+	args := []interface{}{credit.MovieID, credit.PersonID, credit.Role, credit.Character, credit.BillingOrder}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&credit.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "credits_movie_person_role_key"`:
+			return ErrDuplicateCredit
+		case err.Error() == `pq: insert or update on table "credits" violates foreign key constraint "credits_movie_id_fkey"`,
+			err.Error() == `pq: insert or update on table "credits" violates foreign key constraint "credits_person_id_fkey"`:
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAllForMovie retrieves the credits of a movie, in billing order.
+func (m CreditModel) GetAllForMovie(movieID int64) ([]*Credit, error) {
+	query := `
+	SELECT credits.id, credits.movie_id, credits.person_id, people.name, credits.role,
+	credits.character, credits.billing_order
+	FROM credits
+	INNER JOIN people ON people.id = credits.person_id
+	WHERE credits.movie_id = $1
+	ORDER BY credits.billing_order, credits.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*Credit{}
+
+	for rows.Next() {
+		var credit Credit
+
+		err = rows.Scan(
+			&credit.ID,
+			&credit.MovieID,
+			&credit.PersonID,
+			&credit.PersonName,
+			&credit.Role,
+			&credit.Character,
+			&credit.BillingOrder,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		credits = append(credits, &credit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+// GetAllForPerson retrieves the credits of a person, newest movies first. Credits on
+// movies in the trash are left out.
+func (m CreditModel) GetAllForPerson(personID int64) ([]*Credit, error) {
+	query := `
+	SELECT credits.id, credits.movie_id, credits.person_id, movies.title, credits.role,
+	credits.character, credits.billing_order
+	FROM credits
+	INNER JOIN movies ON movies.id = credits.movie_id
+	WHERE credits.person_id = $1 AND movies.deleted_at IS NULL
+	ORDER BY movies.year DESC, movies.id, credits.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, personID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*Credit{}
+
+	for rows.Next() {
+		var credit Credit
+
+		err = rows.Scan(
+			&credit.ID,
+			&credit.MovieID,
+			&credit.PersonID,
+			&credit.MovieTitle,
+			&credit.Role,
+			&credit.Character,
+			&credit.BillingOrder,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		credits = append(credits, &credit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+// DeleteForMovie deletes a credit from a movie.
+func (m CreditModel) DeleteForMovie(movieID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM credits
+	WHERE id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// EmailChangeModel stores the new email address a user has asked to change to, keyed
+// by the email-change token that was sent to that address. The email address is only
+// changed once the user proves they own it by sending the token back.
+type EmailChangeModel struct {
+	DB *sql.DB
+}
+
+// New creates an email-change token for a specific user and new email address. Any
+// earlier email-change tokens for the user are deleted, so only the latest request
+// can be confirmed.
+func (m EmailChangeModel) New(userID int64, email string, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeEmailChange)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	DELETE FROM tokens
+	WHERE scope = $1 AND user_id = $2`
+
+	_, err = tx.ExecContext(ctx, query, ScopeEmailChange, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	INSERT INTO tokens (hash, user_id, expiry, scope)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, last_used_at`
+
+	err = tx.QueryRowContext(ctx, query, token.Hash, token.UserID, token.Expiry, token.Scope).Scan(&token.ID, &token.CreatedAt, &token.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	INSERT INTO email_changes (token_hash, email)
+	VALUES ($1, $2)`
+
+	_, err = tx.ExecContext(ctx, query, token.Hash, email)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, tx.Commit()
+}
+
+// GetForToken retrieves the ID of the user and the new email address associated with
+// an unexpired email-change token.
+func (m EmailChangeModel) GetForToken(tokenPlaintext string) (int64, string, error) {
+	query := `
+	SELECT tokens.user_id, email_changes.email
+	FROM email_changes
+	INNER JOIN tokens ON tokens.hash = email_changes.token_hash
+	WHERE tokens.hash = $1
+	AND tokens.scope = $2
+	AND tokens.expiry > $3`
+
+	var (
+		userID int64
+		email  string
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hashToken(tokenPlaintext), ScopeEmailChange, time.Now()).Scan(&userID, &email)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, "", ErrRecordNotFound
+		default:
+			return 0, "", err
+		}
+	}
+
+	return userID, email, nil
+}
@@ -0,0 +1,148 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hafizmfadli/go-movie/internal/validator"
+	"github.com/lib/pq"
+)
+
+// nonSlugChars matches the runs of characters which genreSlug replaces with a hyphen.
+var nonSlugChars = regexp.MustCompile("[^a-z0-9]+")
+
+// Genre is an entry in the genre taxonomy. Movies refer to genres by slug, and the
+// name and aliases are used to recognize genres which clients send in other forms.
+type Genre struct {
+	Slug    string   `json:"slug"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+	// MovieCount is the number of movies with the genre
+	MovieCount int `json:"movie_count"`
+}
+
+// genreSlug turns a free-text genre into the slug format, e.g. "Film Noir" into
+// "film-noir". It matches the genre_slug() function used by the migration which
+// normalized the existing movies. Only ASCII letters and digits are kept, so a genre
+// without any, such as "ドラマ", has an empty slug.
+func genreSlug(genre string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(genre), "-"), "-")
+}
+
+// ValidateGenres checks that Normalize didn't find any unknown genres. It should be
+// called before ValidateMovie, so that its more specific message is the one reported.
+func ValidateGenres(v *validator.Validator, unknown []string) {
+	if len(unknown) > 0 {
+		v.AddError("genres", fmt.Sprintf("must only contain known genres, %q is not one", unknown[0]))
+	}
+}
+
+type GenreModel struct {
+	DB *sql.DB
+}
+
+// GetAll retrieves all the genres, along with the number of movies with each genre.
+func (m GenreModel) GetAll() ([]*Genre, error) {
+	query := `
+	SELECT genres.slug, genres.name, genres.aliases, count(movies.id)
+	FROM genres
+	LEFT JOIN movies ON movies.genres @> ARRAY[genres.slug] AND movies.deleted_at IS NULL
+	GROUP BY genres.slug
+	ORDER BY genres.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+
+	for rows.Next() {
+		var genre Genre
+
+		err = rows.Scan(&genre.Slug, &genre.Name, pq.Array(&genre.Aliases), &genre.MovieCount)
+		if err != nil {
+			return nil, err
+		}
+
+		genres = append(genres, &genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+// Normalize maps each of values to the slug of the genre whose slug, name or alias it
+// matches, ignoring case, spacing and punctuation. The slugs are returned in the same
+// order as values, along with the values which don't match any genre. An empty values
+// is returned as it is without querying the database, so a missing (nil) list of
+// genres can still be told apart from an empty one.
+func (m GenreModel) Normalize(values []string) ([]string, []string, error) {
+	if len(values) == 0 {
+		return values, nil, nil
+	}
+
+	query := `
+	SELECT slug, name, aliases
+	FROM genres`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	known := make(map[string]string)
+
+	for rows.Next() {
+		var genre Genre
+
+		err = rows.Scan(&genre.Slug, &genre.Name, pq.Array(&genre.Aliases))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, alias := range genre.Aliases {
+			known[genreSlug(alias)] = genre.Slug
+		}
+		known[genreSlug(genre.Name)] = genre.Slug
+		known[genre.Slug] = genre.Slug
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// An empty slug must never match, so that values without one are reported as
+	// unknown rather than being mapped to some genre.
+	delete(known, "")
+
+	slugs := []string{}
+	unknown := []string{}
+
+	for _, value := range values {
+		slug, ok := known[genreSlug(value)]
+		if !ok {
+			unknown = append(unknown, value)
+			continue
+		}
+
+		slugs = append(slugs, slug)
+	}
+
+	return slugs, unknown, nil
+}
@@ -0,0 +1,184 @@
+package data
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrUnknownHashFormat is returned when a stored password hash wasn't created by
+	// any of the hashers we know about.
+	ErrUnknownHashFormat = errors.New("unknown password hash format")
+)
+
+// PasswordHasher is the hasher which new password hashes are created with. Hashes
+// created by any of the other known hashers, or by the same hasher with different
+// parameters, are upgraded to it the next time the user logs in.
+var PasswordHasher Hasher = BcryptHasher{Cost: 12}
+
+// Hasher creates and checks password hashes. Hashes are self-describing: they record
+// which algorithm and parameters were used, so that they can be checked after the
+// PasswordHasher has changed.
+type Hasher interface {
+	// Hash returns the hash of a plaintext password, using a new random salt.
+	Hash(plaintext string) ([]byte, error)
+	// Recognizes reports whether hash was created by this kind of hasher.
+	Recognizes(hash []byte) bool
+	// Matches reports whether plaintext is the password that hash was created from.
+	Matches(plaintext string, hash []byte) (bool, error)
+	// Outdated reports whether hash was created with different parameters than the
+	// hasher would use now.
+	Outdated(hash []byte) bool
+}
+
+// hasherFor returns the hasher which understands the format of hash. PasswordHasher is
+// preferred, so that its parameters are used when checking whether hash is outdated.
+func hasherFor(hash []byte) (Hasher, error) {
+	candidates := []Hasher{PasswordHasher, BcryptHasher{}, Argon2idHasher{}}
+
+	for _, h := range candidates {
+		if h.Recognizes(hash) {
+			return h, nil
+		}
+	}
+
+	return nil, ErrUnknownHashFormat
+}
+
+// BcryptHasher hashes passwords with bcrypt. Its hashes are in the standard
+// "$2a$<cost>$<salt and hash>" format.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(plaintext string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(plaintext), h.Cost)
+}
+
+func (h BcryptHasher) Recognizes(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$2a$")) || bytes.HasPrefix(hash, []byte("$2b$")) || bytes.HasPrefix(hash, []byte("$2y$"))
+}
+
+func (h BcryptHasher) Matches(plaintext string, hash []byte) (bool, error) {
+	err := bcrypt.CompareHashAndPassword(hash, []byte(plaintext))
+	if err != nil {
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (h BcryptHasher) Outdated(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	return err != nil || cost != h.Cost
+}
+
+// Argon2idHasher hashes passwords with Argon2id (RFC 9106). Its hashes are in the PHC
+// string format, "$argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>",
+// with the salt and key base64 encoded without padding.
+type Argon2idHasher struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// argon2idParams holds the parameters decoded from an Argon2id hash.
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h Argon2idHasher) Hash(plaintext string) ([]byte, error) {
+	salt := make([]byte, argon2SaltLength)
+
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(plaintext), salt, h.Iterations, h.Memory, h.Parallelism, argon2KeyLength)
+
+	hash := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return []byte(hash), nil
+}
+
+func (h Argon2idHasher) Recognizes(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte("$argon2id$"))
+}
+
+func (h Argon2idHasher) Matches(plaintext string, hash []byte) (bool, error) {
+	params, err := decodeArgon2idHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(plaintext), params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+func (h Argon2idHasher) Outdated(hash []byte) bool {
+	params, err := decodeArgon2idHash(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.memory != h.Memory || params.iterations != h.Iterations || params.parallelism != h.Parallelism || len(params.key) != argon2KeyLength
+}
+
+func decodeArgon2idHash(hash []byte) (*argon2idParams, error) {
+	parts := bytes.Split(hash, []byte("$"))
+	if len(parts) != 6 || string(parts[1]) != "argon2id" {
+		return nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	_, err := fmt.Sscanf(string(parts[2]), "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return nil, ErrUnknownHashFormat
+	}
+
+	var params argon2idParams
+
+	_, err = fmt.Sscanf(string(parts[3]), "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism)
+	if err != nil {
+		return nil, ErrUnknownHashFormat
+	}
+
+	params.salt, err = base64.RawStdEncoding.DecodeString(string(parts[4]))
+	if err != nil {
+		return nil, ErrUnknownHashFormat
+	}
+
+	params.key, err = base64.RawStdEncoding.DecodeString(string(parts[5]))
+	if err != nil || len(params.key) == 0 {
+		return nil, ErrUnknownHashFormat
+	}
+
+	return &params, nil
+}
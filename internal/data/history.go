@@ -0,0 +1,214 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hafizmfadli/go-movie/internal/validator"
+	"github.com/lib/pq"
+)
+
+// HistoryEntry records that a user watched a movie. A movie can be in a user's history
+// more than once, if they have watched it again.
+type HistoryEntry struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	Movie     *Movie    `json:"movie"`
+	WatchedAt time.Time `json:"watched_at"`
+}
+
+func ValidateHistoryEntry(v *validator.Validator, entry *HistoryEntry) {
+	v.Check(entry.Movie.ID > 0, "movie_id", "must be provided")
+	v.Check(!entry.WatchedAt.After(time.Now()), "watched_at", "must not be in the future")
+}
+
+type HistoryModel struct {
+	DB *sql.DB
+}
+
+// Insert inserts a new record in the watch_history table, and removes the movie from
+// the user's watchlist now that they have watched it.
+func (m HistoryModel) Insert(entry *HistoryEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO watch_history (user_id, movie_id, watched_at)
+	VALUES ($1, $2, $3)
+	RETURNING id`
+
+	err = tx.QueryRowContext(ctx, query, entry.UserID, entry.Movie.ID, entry.WatchedAt).Scan(&entry.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: insert or update on table "watch_history" violates foreign key constraint "watch_history_movie_id_fkey"`:
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	query = `
+	DELETE FROM watchlist
+	WHERE user_id = $1 AND movie_id = $2`
+
+	_, err = tx.ExecContext(ctx, query, entry.UserID, entry.Movie.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteForUser deletes an entry from a user's history.
+func (m HistoryModel) DeleteForUser(userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM watch_history
+	WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllForUser retrieves a page of a user's history, along with the movies in it.
+// Movies in the trash are left out until they are restored.
+func (m HistoryModel) GetAllForUser(userID int64, filters Filters) ([]*HistoryEntry, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), watch_history.id, watch_history.user_id, watch_history.watched_at,
+	movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres,
+	movies.rating, movies.votes, movies.version
+	FROM watch_history
+	INNER JOIN movies ON movies.id = watch_history.movie_id
+	WHERE watch_history.user_id = $1 AND movies.deleted_at IS NULL
+	ORDER BY %s %s, watch_history.id ASC
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	args := []interface{}{userID, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	entries := []*HistoryEntry{}
+	totalRecords := 0
+
+	for rows.Next() {
+		entry := HistoryEntry{Movie: &Movie{}}
+
+		err = rows.Scan(
+			&totalRecords,
+			&entry.ID,
+			&entry.UserID,
+			&entry.WatchedAt,
+			&entry.Movie.ID,
+			&entry.Movie.CreatedAt,
+			&entry.Movie.Title,
+			&entry.Movie.Year,
+			&entry.Movie.Runtime,
+			pq.Array(&entry.Movie.Genres),
+			&entry.Movie.Rating,
+			&entry.Movie.Votes,
+			&entry.Movie.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return entries, metadata, nil
+}
+
+// GetAllForExport retrieves a user's whole history, newest first, for the export of
+// their account. Unlike GetAllForUser it isn't paginated, and movies in the trash are
+// included, as the entries are still the user's data.
+func (m HistoryModel) GetAllForExport(userID int64) ([]*HistoryEntry, error) {
+	query := `
+	SELECT watch_history.id, watch_history.user_id, watch_history.watched_at,
+	movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres,
+	movies.rating, movies.votes, movies.version
+	FROM watch_history
+	INNER JOIN movies ON movies.id = watch_history.movie_id
+	WHERE watch_history.user_id = $1
+	ORDER BY watch_history.watched_at DESC, watch_history.id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*HistoryEntry{}
+
+	for rows.Next() {
+		entry := HistoryEntry{Movie: &Movie{}}
+
+		err = rows.Scan(
+			&entry.ID,
+			&entry.UserID,
+			&entry.WatchedAt,
+			&entry.Movie.ID,
+			&entry.Movie.CreatedAt,
+			&entry.Movie.Title,
+			&entry.Movie.Year,
+			&entry.Movie.Runtime,
+			pq.Array(&entry.Movie.Genres),
+			&entry.Movie.Rating,
+			&entry.Movie.Votes,
+			&entry.Movie.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,127 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrDuplicateIdentity = errors.New("duplicate identity")
+)
+
+// Identity links an account at an external OpenID Connect provider to a user. The
+// provider's subject identifier is stable, unlike the email address, so it is what we
+// look users up by when they log in.
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	UserID    int64     `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type IdentityModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a new record to the user_identities table and sets identity.CreatedAt.
+func (m IdentityModel) Insert(identity *Identity) error {
+	query := `
+	INSERT INTO user_identities (provider, subject, user_id, email)
+	VALUES ($1, $2, $3, $4)
+	RETURNING created_at`
+
+	args := []interface{}{identity.Provider, identity.Subject, identity.UserID, identity.Email}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&identity.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "user_identities_pkey"`:
+			return ErrDuplicateIdentity
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get retrieves the identity with a specific provider and subject.
+func (m IdentityModel) Get(provider, subject string) (*Identity, error) {
+	query := `
+	SELECT provider, subject, user_id, email, created_at
+	FROM user_identities
+	WHERE provider = $1 AND subject = $2`
+
+	var identity Identity
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, provider, subject).Scan(
+		&identity.Provider,
+		&identity.Subject,
+		&identity.UserID,
+		&identity.Email,
+		&identity.CreatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &identity, nil
+}
+
+// GetAllForUser returns all identities linked to a specific user.
+func (m IdentityModel) GetAllForUser(userID int64) ([]*Identity, error) {
+	query := `
+	SELECT provider, subject, user_id, email, created_at
+	FROM user_identities
+	WHERE user_id = $1
+	ORDER BY created_at, provider`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*Identity{}
+
+	for rows.Next() {
+		var identity Identity
+
+		err := rows.Scan(
+			&identity.Provider,
+			&identity.Subject,
+			&identity.UserID,
+			&identity.Email,
+			&identity.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, &identity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
@@ -0,0 +1,215 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/hafizmfadli/go-movie/internal/validator"
+	"github.com/lib/pq"
+)
+
+// Invitation lets somebody register while the API is in invite-only mode. The account
+// is created with the invited email address and permissions, and is activated
+// straight away because the invitation was sent to that address.
+type Invitation struct {
+	ID int64 `json:"id"`
+	// Plaintext is only set when the invitation is created, so that it can be emailed
+	// to the invitee. It is never stored.
+	Plaintext   string      `json:"-"`
+	Hash        []byte      `json:"-"`
+	Email       string      `json:"email"`
+	Permissions Permissions `json:"permissions"`
+	Expiry      time.Time   `json:"expiry"`
+	// CreatedBy is the ID of the admin who sent the invitation. It is nil if their
+	// account has since been deleted.
+	CreatedBy  *int64     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+}
+
+func ValidateInvitation(v *validator.Validator, invitation *Invitation) {
+	ValidateEmail(v, invitation.Email)
+	v.Check(invitation.Permissions != nil, "permissions", "must be provided")
+	v.Check(len(invitation.Permissions) >= 1, "permissions", "must contain at least 1 permission")
+	v.Check(validator.Unique(invitation.Permissions), "permissions", "must not contain duplicate values")
+	v.Check(invitation.Expiry.After(time.Now()), "expiry", "must be in the future")
+}
+
+type InvitationModel struct {
+	DB *sql.DB
+}
+
+// New creates a new invitation and inserts it in the invitations table.
+func (m InvitationModel) New(email string, permissions Permissions, expiry time.Time, createdBy int64) (*Invitation, error) {
+	// Invitations use the same format as our other tokens, so that they can be
+	// validated with ValidateTokenPlaintext.
+	token, err := generateToken(0, time.Until(expiry), "")
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := &Invitation{
+		Plaintext:   token.Plaintext,
+		Hash:        token.Hash,
+		Email:       email,
+		Permissions: permissions,
+		Expiry:      expiry,
+		CreatedBy:   &createdBy,
+	}
+
+	query := `
+	INSERT INTO invitations (hash, email, permissions, expiry, created_by)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+
+	args := []interface{}{invitation.Hash, invitation.Email, pq.Array(invitation.Permissions), invitation.Expiry, invitation.CreatedBy}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&invitation.ID, &invitation.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// GetForPlaintext retrieves the unexpired and unaccepted invitation whose hash matches
+// the provided plaintext token.
+func (m InvitationModel) GetForPlaintext(tokenPlaintext string) (*Invitation, error) {
+	query := `
+	SELECT id, email, permissions, expiry, created_by, created_at, accepted_at
+	FROM invitations
+	WHERE hash = $1 AND expiry > $2 AND accepted_at IS NULL`
+
+	var invitation Invitation
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hashToken(tokenPlaintext), time.Now()).Scan(
+		&invitation.ID,
+		&invitation.Email,
+		pq.Array(&invitation.Permissions),
+		&invitation.Expiry,
+		&invitation.CreatedBy,
+		&invitation.CreatedAt,
+		&invitation.AcceptedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &invitation, nil
+}
+
+// GetAll returns all invitations, including the expired and accepted ones, newest first.
+func (m InvitationModel) GetAll() ([]*Invitation, error) {
+	query := `
+	SELECT id, email, permissions, expiry, created_by, created_at, accepted_at
+	FROM invitations
+	ORDER BY id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+
+	for rows.Next() {
+		var invitation Invitation
+
+		err := rows.Scan(
+			&invitation.ID,
+			&invitation.Email,
+			pq.Array(&invitation.Permissions),
+			&invitation.Expiry,
+			&invitation.CreatedBy,
+			&invitation.CreatedAt,
+			&invitation.AcceptedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		invitations = append(invitations, &invitation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// Accept marks an invitation as used. If it has already been accepted,
+// ErrEditConflict is returned.
+func (m InvitationModel) Accept(id int64) error {
+	query := `
+	UPDATE invitations
+	SET accepted_at = NOW()
+	WHERE id = $1 AND accepted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Delete revokes an invitation.
+func (m InvitationModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM invitations
+	WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
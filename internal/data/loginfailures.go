@@ -0,0 +1,238 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hafizmfadli/go-movie/internal/validator"
+)
+
+const (
+	// LoginFailureAccount failures are tracked per email address, whether or not a
+	// user with that email address exists.
+	LoginFailureAccount = "account"
+	// LoginFailureIP failures are tracked per client IP address.
+	LoginFailureIP = "ip"
+)
+
+const (
+	// loginFreeFailures is the number of failed attempts which are allowed before we
+	// start making the client wait between attempts.
+	loginFreeFailures = 3
+	// loginMaxBackoff is the longest we make the client wait between attempts, short
+	// of locking them out.
+	loginMaxBackoff = 5 * time.Minute
+)
+
+// LoginFailure holds the failed login attempts for a single account or IP address.
+type LoginFailure struct {
+	Kind          string     `json:"kind"`
+	Subject       string     `json:"subject"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+// RetryAfter returns how long the client must wait before trying to log in again.
+// Once there have been more than a few failures, the wait doubles with every failure,
+// and while the account or IP address is locked, the client must wait for the lock
+// to expire.
+func (f *LoginFailure) RetryAfter(now time.Time) time.Duration {
+	if f.LockedUntil != nil && f.LockedUntil.After(now) {
+		return f.LockedUntil.Sub(now)
+	}
+
+	if f.Failures < loginFreeFailures {
+		return 0
+	}
+
+	backoff := loginMaxBackoff
+	if shift := f.Failures - loginFreeFailures; shift < 16 {
+		backoff = time.Second << shift
+		if backoff > loginMaxBackoff {
+			backoff = loginMaxBackoff
+		}
+	}
+
+	wait := f.LastFailureAt.Add(backoff).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+func ValidateLoginFailureKind(v *validator.Validator, kind string) {
+	v.Check(validator.In(kind, LoginFailureAccount, LoginFailureIP), "kind", fmt.Sprintf("must be %q or %q", LoginFailureAccount, LoginFailureIP))
+}
+
+type LoginFailureModel struct {
+	DB *sql.DB
+}
+
+// Get retrieves the failed login attempts for a specific account or IP address.
+func (m LoginFailureModel) Get(kind, subject string) (*LoginFailure, error) {
+	query := `
+	SELECT kind, subject, failures, last_failure_at, locked_until
+	FROM login_failures
+	WHERE kind = $1 AND subject = $2`
+
+	var f LoginFailure
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, kind, subject).Scan(
+		&f.Kind,
+		&f.Subject,
+		&f.Failures,
+		&f.LastFailureAt,
+		&f.LockedUntil,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &f, nil
+}
+
+// Record adds a failed login attempt for a specific account or IP address. Failures
+// older than the lockout duration are forgotten. When the number of failures reaches
+// maxFailures, the account or IP address is locked for the lockout duration and the
+// count starts again. The returned bool reports whether this failure caused a lock.
+func (m LoginFailureModel) Record(kind, subject string, maxFailures int, lockout time.Duration) (*LoginFailure, bool, error) {
+	query := `
+	INSERT INTO login_failures (kind, subject, failures, last_failure_at)
+	VALUES ($1, $2, 1, NOW())
+	ON CONFLICT (kind, subject) DO UPDATE
+	SET failures = CASE
+		WHEN login_failures.last_failure_at < NOW() - make_interval(secs => $3) THEN 1
+		ELSE login_failures.failures + 1
+	END,
+	last_failure_at = NOW()
+	RETURNING kind, subject, failures, last_failure_at, locked_until`
+
+	var f LoginFailure
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, kind, subject, lockout.Seconds()).Scan(
+		&f.Kind,
+		&f.Subject,
+		&f.Failures,
+		&f.LastFailureAt,
+		&f.LockedUntil,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if f.Failures < maxFailures {
+		return &f, false, nil
+	}
+
+	query = `
+	UPDATE login_failures
+	SET failures = 0, locked_until = $3
+	WHERE kind = $1 AND subject = $2`
+
+	lockedUntil := time.Now().Add(lockout)
+
+	_, err = m.DB.ExecContext(ctx, query, kind, subject, lockedUntil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	f.Failures = 0
+	f.LockedUntil = &lockedUntil
+
+	return &f, true, nil
+}
+
+// Delete forgets the failed login attempts for a specific account or IP address,
+// which also lifts any lock.
+func (m LoginFailureModel) Delete(kind, subject string) error {
+	query := `
+	DELETE FROM login_failures
+	WHERE kind = $1 AND subject = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, kind, subject)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAll returns the failed login attempts for every account and IP address, optionally
+// only those of a specific kind, or only those which are currently locked.
+func (m LoginFailureModel) GetAll(kind string, lockedOnly bool, filters Filters) ([]*LoginFailure, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), kind, subject, failures, last_failure_at, locked_until
+	FROM login_failures
+	WHERE (kind = $1 OR $1 = '')
+	AND (locked_until > NOW() OR NOT $2)
+	ORDER BY %s %s, kind ASC, subject ASC
+	LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	args := []interface{}{kind, lockedOnly, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	failures := []*LoginFailure{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var f LoginFailure
+
+		err = rows.Scan(
+			&totalRecords,
+			&f.Kind,
+			&f.Subject,
+			&f.Failures,
+			&f.LastFailureAt,
+			&f.LockedUntil,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		failures = append(failures, &f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return failures, metadata, nil
+}
@@ -0,0 +1,70 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// MagicLinkRequests counts the magic links requested for an email address within the
+// current rate limit window.
+type MagicLinkRequests struct {
+	Email           string
+	Requests        int
+	WindowStartedAt time.Time
+}
+
+// RetryAfter returns how long the client must wait before another magic link can be
+// sent, given the number of requests allowed per window. It is zero while the limit
+// hasn't been reached.
+func (r *MagicLinkRequests) RetryAfter(maxRequests int, window time.Duration, now time.Time) time.Duration {
+	if r.Requests <= maxRequests {
+		return 0
+	}
+
+	wait := r.WindowStartedAt.Add(window).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+type MagicLinkRequestModel struct {
+	DB *sql.DB
+}
+
+// Record counts a magic link request for an email address, whether or not it belongs
+// to a user. A new window is started once the previous one is over. Counting and
+// checking happen in a single statement, so concurrent requests can't both slip under
+// the limit.
+func (m MagicLinkRequestModel) Record(email string, window time.Duration) (*MagicLinkRequests, error) {
+	query := `
+	INSERT INTO magic_link_requests (email, requests, window_started_at)
+	VALUES ($1, 1, NOW())
+	ON CONFLICT (email) DO UPDATE
+	SET requests = CASE
+		WHEN magic_link_requests.window_started_at < NOW() - make_interval(secs => $2) THEN 1
+		ELSE magic_link_requests.requests + 1
+	END,
+	window_started_at = CASE
+		WHEN magic_link_requests.window_started_at < NOW() - make_interval(secs => $2) THEN NOW()
+		ELSE magic_link_requests.window_started_at
+	END
+	RETURNING email, requests, window_started_at`
+
+	var r MagicLinkRequests
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, email, window.Seconds()).Scan(
+		&r.Email,
+		&r.Requests,
+		&r.WindowStartedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
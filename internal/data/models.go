@@ -16,35 +16,173 @@ var (
 // Models is 'container' which can hold and respresent all your database models
 type Models struct {
 	Movies interface {
-		Insert(movie *Movie) error
+		Insert(movie *Movie, userID int64) error
 		Get(id int64) (*Movie, error)
-		Update(movie *Movie) error
+		Update(movie *Movie, userID int64) error
+		Delete(id int64, version int32, userID int64) error
+		Restore(id, userID int64) error
+		Purge(before time.Time) (int64, error)
+		GetAllTrashed(filters Filters) ([]*Movie, Metadata, error)
+		GetAll(title string, genres []string, minRating float64, personID int64, filters Filters) ([]*Movie, Metadata, error)
+	}
+	Revisions interface {
+		GetAllForMovie(movieID int64) ([]*Revision, error)
+		GetAllForUser(userID int64) ([]*Revision, error)
+		GetForVersion(movieID int64, version int32) (*Revision, error)
+	}
+	Genres interface {
+		GetAll() ([]*Genre, error)
+		Normalize(values []string) ([]string, []string, error)
+	}
+	People interface {
+		Insert(person *Person) error
+		Get(id int64) (*Person, error)
+		Update(person *Person) error
 		Delete(id int64) error
-		GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error)
+		GetAll(name string, filters Filters) ([]*Person, Metadata, error)
+	}
+	Credits interface {
+		Insert(credit *Credit) error
+		GetAllForMovie(movieID int64) ([]*Credit, error)
+		GetAllForPerson(personID int64) ([]*Credit, error)
+		DeleteForMovie(movieID, id int64) error
+	}
+	Reviews interface {
+		Insert(review *Review) error
+		GetForUser(movieID, userID int64) (*Review, error)
+		GetAllForMovie(movieID int64, filters Filters) ([]*Review, Metadata, error)
+		GetAllForUser(userID int64) ([]*Review, error)
+		Update(review *Review) error
+		DeleteForUser(movieID, userID int64) error
+	}
+	Watchlist interface {
+		Add(userID, movieID int64) (*WatchlistEntry, error)
+		Remove(userID, movieID int64) error
+		GetAllForUser(userID int64, filters Filters) ([]*WatchlistEntry, Metadata, error)
+		GetAllForExport(userID int64) ([]*WatchlistEntry, error)
+		Contains(userID int64, movieIDs []int64) (map[int64]bool, error)
+	}
+	History interface {
+		Insert(entry *HistoryEntry) error
+		DeleteForUser(userID, id int64) error
+		GetAllForUser(userID int64, filters Filters) ([]*HistoryEntry, Metadata, error)
+		GetAllForExport(userID int64) ([]*HistoryEntry, error)
 	}
 	Users interface {
 		Insert(user *User) error
+		Get(id int64) (*User, error)
 		GetByEmail(email string) (*User, error)
+		GetAll(name, email string, activated *bool, filters Filters) ([]*User, Metadata, error)
 		Update(user *User) error
+		UpdatePasswordHash(user *User) error
 		GetForToken(tokenScope, tokenPlaintext string) (*User, error)
+		ScheduleDeletion(userID int64, at time.Time) error
+		CancelDeletion(userID int64) error
+		DeleteScheduled() (int64, error)
 	}
 	Tokens interface {
 		Insert(token *Token) error
 		DeleteAllForUser(scope string, userID int64) error
+		Delete(scope, tokenPlaintext string) error
+		DeleteForUser(scope string, userID, id int64) error
+		GetAllForUser(scope string, userID int64) ([]*Token, error)
+		Touch(scope, tokenPlaintext string) error
 		New(userID int64, ttl time.Duration, scope string) (*Token, error)
+		NewSession(userID int64, ttl time.Duration, scope string, familyID int64, userAgent, clientIP string) (*Token, error)
+		NewFamily() (int64, error)
+		DeleteFamily(familyID int64) error
+		GetFamilyID(scope, tokenPlaintext string) (int64, error)
+		DeleteOtherSessions(userID, familyID int64) error
+		Consume(scope, tokenPlaintext string) (*Token, error)
+	}
+	EmailChanges interface {
+		New(userID int64, email string, ttl time.Duration) (*Token, error)
+		GetForToken(tokenPlaintext string) (int64, string, error)
+	}
+	Invitations interface {
+		New(email string, permissions Permissions, expiry time.Time, createdBy int64) (*Invitation, error)
+		GetForPlaintext(tokenPlaintext string) (*Invitation, error)
+		GetAll() ([]*Invitation, error)
+		Accept(id int64) error
+		Delete(id int64) error
+	}
+	Identities interface {
+		Insert(identity *Identity) error
+		Get(provider, subject string) (*Identity, error)
+		GetAllForUser(userID int64) ([]*Identity, error)
+	}
+	OIDCStates interface {
+		New(provider, nonce, codeVerifier string, ttl time.Duration) (*OIDCState, error)
+		Consume(provider, statePlaintext string) (*OIDCState, error)
+	}
+	APIKeys interface {
+		Insert(key *APIKey) error
+		New(userID int64, name string, permissions Permissions, expiry *time.Time) (*APIKey, error)
+		GetForPlaintext(keyPlaintext string) (*APIKey, error)
+		GetAllForUser(userID int64) ([]*APIKey, error)
+		DeleteForUser(userID, id int64) error
+		Touch(id int64) error
+	}
+	TOTP interface {
+		Get(userID int64) (*TOTP, error)
+		Insert(t *TOTP) error
+		Enable(userID int64) error
+		Delete(userID int64) error
+		UseStep(userID, step int64) error
+	}
+	RecoveryCodes interface {
+		NewForUser(userID int64) ([]string, error)
+		Consume(userID int64, code string) error
+		DeleteAllForUser(userID int64) error
+	}
+	LoginFailures interface {
+		Get(kind, subject string) (*LoginFailure, error)
+		Record(kind, subject string, maxFailures int, lockout time.Duration) (*LoginFailure, bool, error)
+		Delete(kind, subject string) error
+		GetAll(kind string, lockedOnly bool, filters Filters) ([]*LoginFailure, Metadata, error)
+	}
+	MagicLinkRequests interface {
+		Record(email string, window time.Duration) (*MagicLinkRequests, error)
+	}
+	Roles interface {
+		GetAll() ([]*Role, error)
+		Exists(name string) (bool, error)
+		GetAllForUser(userID int64) ([]string, error)
+		AddForUser(userID int64, names ...string) error
+		RemoveForUser(userID int64, name string) error
 	}
 	Permissions interface {
+		GetAll() (Permissions, error)
 		GetAllForUser(userID int64) (Permissions, error)
+		GetAllDirectForUser(userID int64) (Permissions, error)
 		AddForUser(userID int64, code ...string) error
+		RemoveForUser(userID int64, code ...string) error
 	}
 }
 
 // NewModels return a Models struct
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Movies:      MovieModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Permissions: PermissionModel{DB: db},
+		Movies:            MovieModel{DB: db},
+		Revisions:         RevisionModel{DB: db},
+		Genres:            GenreModel{DB: db},
+		People:            PersonModel{DB: db},
+		Credits:           CreditModel{DB: db},
+		Reviews:           ReviewModel{DB: db},
+		Watchlist:         WatchlistModel{DB: db},
+		History:           HistoryModel{DB: db},
+		Users:             UserModel{DB: db},
+		Tokens:            TokenModel{DB: db},
+		EmailChanges:      EmailChangeModel{DB: db},
+		Invitations:       InvitationModel{DB: db},
+		Identities:        IdentityModel{DB: db},
+		OIDCStates:        OIDCStateModel{DB: db},
+		APIKeys:           APIKeyModel{DB: db},
+		TOTP:              TOTPModel{DB: db},
+		RecoveryCodes:     RecoveryCodeModel{DB: db},
+		LoginFailures:     LoginFailureModel{DB: db},
+		MagicLinkRequests: MagicLinkRequestModel{DB: db},
+		Roles:             RoleModel{DB: db},
+		Permissions:       PermissionModel{DB: db},
 	}
 }
@@ -24,6 +24,18 @@ type Movie struct {
 	Runtime int32 `json:"runtime,omitempty"`
 	// Slice of genres for the movie (romance, comedy, etc.)
 	Genres []string `json:"genres,omitempty"`
+	// Average review score, from 1 to 10, or 0 if the movie hasn't been reviewed yet
+	Rating float64 `json:"rating"`
+	// Number of reviews the rating is averaged over
+	Votes int32 `json:"votes"`
+	// Whether the movie is on the authenticated user's watchlist. It is only set in
+	// responses to users, and isn't stored on the movie.
+	InWatchlist *bool `json:"in_watchlist,omitempty"`
+	// Cast and crew of the movie. They are only set when the client asks for them.
+	Credits []*Credit `json:"credits,omitempty"`
+	// Timestamp for when the movie was moved to the trash. It is nil for movies which
+	// aren't in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 	// Version number starts at 1 and will be incremented each time the movie is updated
 	Version int32 `json:"version"`
 }
@@ -46,28 +58,46 @@ type MovieModel struct {
 	DB *sql.DB
 }
 
-// Insert inserting a new record in the movies table
-func (m MovieModel) Insert(movie *Movie) error {
+// Insert inserting a new record in the movies table, and recording the revision made by
+// the user with userID
+func (m MovieModel) Insert(movie *Movie, userID int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `INSERT INTO movies (title, year, runtime, genres) VALUES ($1, $2, $3, $4)
 	RETURNING id, created_at, version`
 
 	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	if err != nil {
+		return err
+	}
+
+	err = insertRevision(ctx, tx, movie, RevisionInsert, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-// Get fetching a specific record from the movies table
+// Get fetching a specific record from the movies table. Movies in the trash aren't
+// returned.
 func (m MovieModel) Get(id int64) (*Movie, error) {
 
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `SELECT id, created_at, title, year, runtime, genres, version
-	FROM movies WHERE id = $1`
+	query := `SELECT id, created_at, title, year, runtime, genres, rating, votes, version
+	FROM movies WHERE id = $1 AND deleted_at IS NULL`
 
 	movie := Movie{}
 
@@ -75,7 +105,7 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(&movie.ID, &movie.CreatedAt, &movie.Title, &movie.Year,
-		&movie.Runtime, pq.Array(&movie.Genres), &movie.Version)
+		&movie.Runtime, pq.Array(&movie.Genres), &movie.Rating, &movie.Votes, &movie.Version)
 
 	if err != nil {
 		switch {
@@ -89,19 +119,26 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
-// Update updating a specific record in the movies table
-func (m MovieModel) Update(movie *Movie) error {
+// Update updating a specific record in the movies table, and recording the revision made
+// by the user with userID
+func (m MovieModel) Update(movie *Movie, userID int64) error {
 	query := `UPDATE movies 
 	SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-	WHERE id = $5 AND version = $6
-	RETURNING version`
+	WHERE id = $5 AND version = $6 AND deleted_at IS NULL
+	RETURNING rating, votes, version`
 
 	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ID, movie.Version}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.Rating, &movie.Votes, &movie.Version)
 
 	if err != nil {
 		switch {
@@ -112,49 +149,177 @@ func (m MovieModel) Update(movie *Movie) error {
 		}
 	}
 
+	err = insertRevision(ctx, tx, movie, RevisionUpdate, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete moving a specific record in the movies table to the trash, and recording the
+// revision made by the user with userID. Like Update, it only succeeds while the record
+// is still at the given version. Movies in the trash can be restored until they are
+// purged.
+func (m MovieModel) Delete(id int64, version int32, userID int64) error {
+
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `UPDATE movies SET deleted_at = NOW()
+	WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+	RETURNING id, title, year, runtime, genres, version`
+
+	err := m.setDeleted(query, RevisionDelete, userID, id, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
 	return nil
 }
 
-// Delete deleting a specific record from the movies table
-func (m MovieModel) Delete(id int64) error {
+// Restore taking a specific record in the movies table out of the trash, and recording
+// the revision made by the user with userID
+func (m MovieModel) Restore(id, userID int64) error {
 
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	query := `DELETE FROM movies WHERE id = $1`
+	query := `UPDATE movies SET deleted_at = NULL
+	WHERE id = $1 AND deleted_at IS NOT NULL
+	RETURNING id, title, year, runtime, genres, version`
+
+	return m.setDeleted(query, RevisionRestore, userID, id)
+}
+
+// setDeleted runs query with args, which moves a movie into or out of the trash, and
+// records the revision in the same transaction.
+func (m MovieModel) setDeleted(query string, action string, userID int64, args ...interface{}) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	result, err := m.DB.ExecContext(ctx, query, id)
+
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	var movie Movie
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.Title, &movie.Year, &movie.Runtime,
+		pq.Array(&movie.Genres), &movie.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
 
-	rowsAffected, err := result.RowsAffected()
+	err = insertRevision(ctx, tx, &movie, action, userID)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	return tx.Commit()
+}
+
+// Purge permanently deleting the records which were moved to the trash before the given
+// time. It returns the number of movies deleted.
+func (m MovieModel) Purge(before time.Time) (int64, error) {
+	query := `DELETE FROM movies WHERE deleted_at < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	return result.RowsAffected()
+}
+
+// GetAllTrashed retrieves a page of the movies in the trash.
+func (m MovieModel) GetAllTrashed(filters Filters) ([]*Movie, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, rating, votes, deleted_at, version
+	FROM movies
+	WHERE deleted_at IS NOT NULL
+	ORDER BY %s %s, id ASC
+	LIMIT $1 OFFSET $2`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var m Movie
+
+		err = rows.Scan(
+			&totalRecords,
+			&m.ID,
+			&m.CreatedAt,
+			&m.Title,
+			&m.Year,
+			&m.Runtime,
+			pq.Array(&m.Genres),
+			&m.Rating,
+			&m.Votes,
+			&m.DeletedAt,
+			&m.Version)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movies, metadata, nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+// GetAll retrieves a page of the movies outside the trash matching title and genres, which have a rating of
+// at least minRating. Movies which haven't been reviewed have a rating of 0. If personID
+// isn't 0, only the movies which that person is credited on are included.
+func (m MovieModel) GetAll(title string, genres []string, minRating float64, personID int64, filters Filters) ([]*Movie, Metadata, error) {
 
 	// notice that we also include a secondary sort on the movie ID to ensure a
 	// consistent ordering.
 	query := fmt.Sprintf(`
-	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, rating, votes, version
 	FROM movies
 	WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
 	AND (genres @> $2 OR $2 = '{}')
+	AND rating >= $3
+	AND (id IN (SELECT movie_id FROM credits WHERE person_id = $4) OR $4 = 0)
+	AND deleted_at IS NULL
 	ORDER BY %s %s, id ASC
-	LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+	LIMIT $5 OFFSET $6`, filters.sortColumn(), filters.sortDirection())
 
-	args := []interface{}{title, pq.Array(genres), filters.limit(), filters.offset()}
+	args := []interface{}{title, pq.Array(genres), minRating, personID, filters.limit(), filters.offset()}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -179,6 +344,8 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 			&m.Year,
 			&m.Runtime,
 			pq.Array(&m.Genres),
+			&m.Rating,
+			&m.Votes,
 			&m.Version)
 
 		if err != nil {
@@ -0,0 +1,102 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// OIDCState holds what we need to remember about an OpenID Connect login between
+// sending the user to the provider and the provider sending them back. The plaintext
+// state is sent to the provider, and only its hash is stored.
+type OIDCState struct {
+	Plaintext    string
+	Hash         []byte
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	Expiry       time.Time
+}
+
+type OIDCStateModel struct {
+	DB *sql.DB
+}
+
+// New creates a new state for a login with a specific provider, and inserts it in the
+// oidc_states table. Expired states are deleted at the same time.
+func (m OIDCStateModel) New(provider, nonce, codeVerifier string, ttl time.Duration) (*OIDCState, error) {
+	token, err := generateToken(0, ttl, "")
+	if err != nil {
+		return nil, err
+	}
+
+	state := &OIDCState{
+		Plaintext:    token.Plaintext,
+		Hash:         token.Hash,
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		Expiry:       token.Expiry,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+	DELETE FROM oidc_states
+	WHERE expiry <= NOW()`
+
+	_, err = m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	INSERT INTO oidc_states (hash, provider, nonce, code_verifier, expiry)
+	VALUES ($1, $2, $3, $4, $5)`
+
+	args := []interface{}{state.Hash, state.Provider, state.Nonce, state.CodeVerifier, state.Expiry}
+
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// Consume deletes and returns the unexpired state for a specific provider whose hash
+// matches the provided plaintext state, so that each state can only be used once.
+func (m OIDCStateModel) Consume(provider, statePlaintext string) (*OIDCState, error) {
+	query := `
+	DELETE FROM oidc_states
+	WHERE hash = $1 AND provider = $2 AND expiry > $3
+	RETURNING hash, provider, nonce, code_verifier, expiry`
+
+	var state OIDCState
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hashToken(statePlaintext), provider, time.Now()).Scan(
+		&state.Hash,
+		&state.Provider,
+		&state.Nonce,
+		&state.CodeVerifier,
+		&state.Expiry,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	state.Plaintext = statePlaintext
+
+	return &state, nil
+}
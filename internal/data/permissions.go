@@ -21,18 +21,36 @@ func (p Permissions) Include(code string) bool {
 	return false
 }
 
+// Intersect returns the permission codes which are in both p and other.
+func (p Permissions) Intersect(other Permissions) Permissions {
+	var permissions Permissions
+
+	for i := range p {
+		if other.Include(p[i]) {
+			permissions = append(permissions, p[i])
+		}
+	}
+	return permissions
+}
+
 type PermissionModel struct {
 	DB *sql.DB
 }
 
-// GetAllForUser get permissions for specific user
+// GetAllForUser get the effective permissions for specific user, which are the
+// permissions granted to them directly plus the permissions of all their roles.
 func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	query := `
 	SELECT permissions.code
 	FROM permissions
 	INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-	INNER JOIN users ON users_permissions.user_id = users.id
-	WHERE users.id = $1
+	WHERE users_permissions.user_id = $1
+	UNION
+	SELECT permissions.code
+	FROM permissions
+	INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+	INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+	WHERE users_roles.user_id = $1
 	`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -63,11 +81,88 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	return permissions, nil
 }
 
-// AddForUser add the provided codes for a specific user.
+// GetAll returns every permission code.
+func (m PermissionModel) GetAll() (Permissions, error) {
+	query := `
+	SELECT code
+	FROM permissions
+	ORDER BY code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// GetAllDirectForUser get the permissions granted directly to specific user, ignoring
+// their roles.
+func (m PermissionModel) GetAllDirectForUser(userID int64) (Permissions, error) {
+	query := `
+	SELECT permissions.code
+	FROM permissions
+	INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+	WHERE users_permissions.user_id = $1
+	ORDER BY permissions.code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := Permissions{}
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// AddForUser add the provided codes for a specific user. Codes which the user already
+// has are ignored.
 func (m PermissionModel) AddForUser(userID int64, code ...string) error {
 	query := `
 	INSERT INTO users_permissions
-	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+	ON CONFLICT DO NOTHING`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -76,3 +171,33 @@ func (m PermissionModel) AddForUser(userID int64, code ...string) error {
 
 	return err
 }
+
+// RemoveForUser revokes the provided codes from a specific user. Note that this only
+// revokes direct grants, so the user keeps any of the permissions which one of their
+// roles bundles.
+func (m PermissionModel) RemoveForUser(userID int64, code ...string) error {
+	query := `
+	DELETE FROM users_permissions
+	USING permissions
+	WHERE users_permissions.permission_id = permissions.id
+	AND users_permissions.user_id = $1 AND permissions.code = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, pq.Array(code))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/hafizmfadli/go-movie/internal/validator"
+	"github.com/lib/pq"
+)
+
+// recoveryCodeCount is the number of recovery codes a user gets when they enable
+// two-factor authentication.
+const recoveryCodeCount = 10
+
+// generateRecoveryCode returns a random code in the format "xxxxx-xxxxx", which is
+// easy to write down and type.
+func generateRecoveryCode() (string, error) {
+	randomBytes := make([]byte, 10)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+
+	return code[:5] + "-" + code[5:10], nil
+}
+
+func ValidateRecoveryCode(v *validator.Validator, code string) {
+	v.Check(code != "", "recovery_code", "must be provided")
+	v.Check(len(code) == 11, "recovery_code", "must be 11 bytes long")
+}
+
+type RecoveryCodeModel struct {
+	DB *sql.DB
+}
+
+// NewForUser replaces any existing recovery codes for a specific user with a new set,
+// and returns the plaintext codes. Only the hashes are stored, so the plaintext codes
+// can't be shown again.
+func (m RecoveryCodeModel) NewForUser(userID int64) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = hashToken(code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	INSERT INTO recovery_codes (user_id, hash)
+	SELECT $1, unnest($2::bytea[])`
+
+	_, err = tx.ExecContext(ctx, query, userID, pq.ByteaArray(hashes))
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, tx.Commit()
+}
+
+// Consume marks an unused recovery code for a specific user as used. If there is no
+// such code, ErrRecordNotFound is returned.
+func (m RecoveryCodeModel) Consume(userID int64, code string) error {
+	query := `
+	UPDATE recovery_codes
+	SET used_at = NOW()
+	WHERE user_id = $1 AND hash = $2 AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, hashToken(strings.ToLower(code)))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteAllForUser deletes all recovery codes for a specific user.
+func (m RecoveryCodeModel) DeleteAllForUser(userID int64) error {
+	query := `
+	DELETE FROM recovery_codes
+	WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,298 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// Actions which are recorded in the movie_revisions table.
+const (
+	RevisionInsert  = "insert"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+)
+
+// MovieSnapshot is the state of the editable fields of a movie at one of its versions.
+type MovieSnapshot struct {
+	Title   string   `json:"title"`
+	Year    int32    `json:"year"`
+	Runtime int32    `json:"runtime"`
+	Genres  []string `json:"genres"`
+}
+
+// FieldChange is a change to one field of a movie between two revisions. From is nil
+// when the movie was created, and To is nil when it was deleted.
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// Revision records a change to a movie, along with who made it and the state of the
+// movie afterwards. For deletes, which move the movie to the trash, the snapshot is the
+// state of the movie when it was deleted.
+type Revision struct {
+	ID      int64  `json:"id"`
+	MovieID int64  `json:"movie_id"`
+	Version int32  `json:"version"`
+	Action  string `json:"action"`
+	// UserID is nil if the change was made before revisions were recorded, or if the
+	// user's account has since been deleted.
+	UserID    *int64        `json:"user_id"`
+	Movie     MovieSnapshot `json:"movie"`
+	Changes   []FieldChange `json:"changes"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// Apply sets the editable fields of movie to the state recorded in the revision.
+func (r *Revision) Apply(movie *Movie) {
+	movie.Title = r.Movie.Title
+	movie.Year = r.Movie.Year
+	movie.Runtime = r.Movie.Runtime
+	movie.Genres = r.Movie.Genres
+}
+
+// insertRevision records a change to movie, as part of the transaction which makes
+// the change. A userID of 0 is recorded as unknown.
+func insertRevision(ctx context.Context, tx *sql.Tx, movie *Movie, action string, userID int64) error {
+	snapshot, err := json.Marshal(MovieSnapshot{
+		Title:   movie.Title,
+		Year:    movie.Year,
+		Runtime: movie.Runtime,
+		Genres:  movie.Genres,
+	})
+	if err != nil {
+		return err
+	}
+
+	var actor *int64
+	if userID > 0 {
+		actor = &userID
+	}
+
+	query := `
+	INSERT INTO movie_revisions (movie_id, version, action, user_id, snapshot)
+	VALUES ($1, $2, $3, $4, $5)`
+
+	_, err = tx.ExecContext(ctx, query, movie.ID, movie.Version, action, actor, snapshot)
+	return err
+}
+
+// diffSnapshots returns the fields which differ between two snapshots, in a fixed
+// order. A nil snapshot means the movie didn't exist.
+func diffSnapshots(from, to *MovieSnapshot) []FieldChange {
+	fields := func(s *MovieSnapshot) []interface{} {
+		if s == nil {
+			return []interface{}{nil, nil, nil, nil}
+		}
+		return []interface{}{s.Title, s.Year, s.Runtime, s.Genres}
+	}
+
+	names := []string{"title", "year", "runtime", "genres"}
+	fromValues, toValues := fields(from), fields(to)
+
+	changes := []FieldChange{}
+
+	for i, name := range names {
+		if !reflect.DeepEqual(fromValues[i], toValues[i]) {
+			changes = append(changes, FieldChange{Field: name, From: fromValues[i], To: toValues[i]})
+		}
+	}
+
+	return changes
+}
+
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+// GetAllForMovie retrieves all the revisions of a movie, oldest first, along with the
+// changes each one made to the revision before it.
+func (m RevisionModel) GetAllForMovie(movieID int64) ([]*Revision, error) {
+	query := `
+	SELECT id, movie_id, version, action, user_id, snapshot, created_at
+	FROM movie_revisions
+	WHERE movie_id = $1
+	ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*Revision{}
+
+	for rows.Next() {
+		var revision Revision
+		var snapshot []byte
+
+		err = rows.Scan(
+			&revision.ID,
+			&revision.MovieID,
+			&revision.Version,
+			&revision.Action,
+			&revision.UserID,
+			&snapshot,
+			&revision.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(snapshot, &revision.Movie)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var previous *MovieSnapshot
+
+	for _, revision := range revisions {
+		if revision.Action == RevisionDelete {
+			revision.Changes = diffSnapshots(previous, nil)
+			previous = nil
+			continue
+		}
+
+		revision.Changes = diffSnapshots(previous, &revision.Movie)
+		previous = &revision.Movie
+	}
+
+	return revisions, nil
+}
+
+// GetAllForUser retrieves all the revisions which a user made, newest first, along with
+// the changes each one made to the revision of the same movie before it.
+func (m RevisionModel) GetAllForUser(userID int64) ([]*Revision, error) {
+	query := `
+	SELECT id, movie_id, version, action, user_id, snapshot, created_at, previous_action,
+	previous_snapshot
+	FROM (
+		SELECT *, lag(action) OVER w AS previous_action, lag(snapshot) OVER w AS previous_snapshot
+		FROM movie_revisions
+		WHERE movie_id IN (SELECT movie_id FROM movie_revisions WHERE user_id = $1)
+		WINDOW w AS (PARTITION BY movie_id ORDER BY id)
+	) AS revisions
+	WHERE user_id = $1
+	ORDER BY id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*Revision{}
+
+	for rows.Next() {
+		var revision Revision
+		var snapshot, previousSnapshot []byte
+		var previousAction sql.NullString
+
+		err = rows.Scan(
+			&revision.ID,
+			&revision.MovieID,
+			&revision.Version,
+			&revision.Action,
+			&revision.UserID,
+			&snapshot,
+			&revision.CreatedAt,
+			&previousAction,
+			&previousSnapshot,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(snapshot, &revision.Movie)
+		if err != nil {
+			return nil, err
+		}
+
+		// As in GetAllForMovie, the movie didn't exist before its first revision or
+		// while it was in the trash.
+		var previous *MovieSnapshot
+
+		if previousAction.Valid && previousAction.String != RevisionDelete {
+			previous = &MovieSnapshot{}
+
+			err = json.Unmarshal(previousSnapshot, previous)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if revision.Action == RevisionDelete {
+			revision.Changes = diffSnapshots(previous, nil)
+		} else {
+			revision.Changes = diffSnapshots(previous, &revision.Movie)
+		}
+
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// GetForVersion retrieves the revision which created the given version of a movie.
+func (m RevisionModel) GetForVersion(movieID int64, version int32) (*Revision, error) {
+	query := `
+	SELECT id, movie_id, version, action, user_id, snapshot, created_at
+	FROM movie_revisions
+	WHERE movie_id = $1 AND version = $2 AND action <> $3
+	ORDER BY id DESC
+	LIMIT 1`
+
+	var revision Revision
+	var snapshot []byte
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, version, RevisionDelete).Scan(
+		&revision.ID,
+		&revision.MovieID,
+		&revision.Version,
+		&revision.Action,
+		&revision.UserID,
+		&snapshot,
+		&revision.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = json.Unmarshal(snapshot, &revision.Movie)
+	if err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
@@ -0,0 +1,176 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrUnknownRole = errors.New("unknown role")
+)
+
+// Role is a named bundle of permission codes which can be assigned to users.
+type Role struct {
+	ID          int64       `json:"id"`
+	Name        string      `json:"name"`
+	Permissions Permissions `json:"permissions"`
+}
+
+type RoleModel struct {
+	DB *sql.DB
+}
+
+// GetAll returns every role together with the permissions it bundles.
+func (m RoleModel) GetAll() ([]*Role, error) {
+	query := `
+	SELECT roles.id, roles.name, COALESCE(array_agg(permissions.code ORDER BY permissions.code)
+		FILTER (WHERE permissions.code IS NOT NULL), '{}')
+	FROM roles
+	LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+	LEFT JOIN permissions ON roles_permissions.permission_id = permissions.id
+	GROUP BY roles.id
+	ORDER BY roles.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+
+	for rows.Next() {
+		var role Role
+
+		err := rows.Scan(&role.ID, &role.Name, pq.Array(&role.Permissions))
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, &role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// Exists reports whether there is a role with a specific name.
+func (m RoleModel) Exists(name string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM roles WHERE name = $1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+
+	err := m.DB.QueryRowContext(ctx, query, name).Scan(&exists)
+	return exists, err
+}
+
+// GetAllForUser returns the names of the roles assigned to a specific user.
+func (m RoleModel) GetAllForUser(userID int64) ([]string, error) {
+	query := `
+	SELECT roles.name
+	FROM roles
+	INNER JOIN users_roles ON users_roles.role_id = roles.id
+	WHERE users_roles.user_id = $1
+	ORDER BY roles.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+
+	for rows.Next() {
+		var role string
+
+		err := rows.Scan(&role)
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// AddForUser assigns the roles with the provided names to a specific user. Roles which
+// the user already has are ignored. If any of the names isn't a known role, nothing is
+// assigned and ErrUnknownRole is returned.
+func (m RoleModel) AddForUser(userID int64, names ...string) error {
+	query := `
+	WITH known AS (
+		SELECT id FROM roles WHERE name = ANY($2)
+	), inserted AS (
+		INSERT INTO users_roles
+		SELECT $1, known.id FROM known
+		WHERE (SELECT count(*) FROM known) = cardinality($2::text[])
+		ON CONFLICT DO NOTHING
+	)
+	SELECT count(*) FROM known`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var known int
+
+	err := m.DB.QueryRowContext(ctx, query, userID, pq.Array(names)).Scan(&known)
+	if err != nil {
+		return err
+	}
+
+	if known != len(names) {
+		return ErrUnknownRole
+	}
+
+	return nil
+}
+
+// RemoveForUser removes the role with the provided name from a specific user.
+func (m RoleModel) RemoveForUser(userID int64, name string) error {
+	query := `
+	DELETE FROM users_roles
+	USING roles
+	WHERE users_roles.role_id = roles.id
+	AND users_roles.user_id = $1 AND roles.name = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -6,22 +6,50 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"time"
 
 	"github.com/hafizmfadli/go-movie/internal/validator"
+	"github.com/lib/pq"
 )
 
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
+	// ScopeTwoFactorPending tokens are issued after a successful password check for
+	// users with two-factor authentication enabled. They must be exchanged, together
+	// with a valid code, for the real authentication token.
+	ScopeTwoFactorPending = "2fa-pending"
+	ScopeEmailChange      = "email-change"
+	ScopeMagicLink        = "magic-link"
+)
+
+var (
+	// ErrTokenReused is returned when a refresh token which has already been
+	// exchanged is presented again. This should never happen for a legitimate
+	// client, so we treat it as a sign that the token has been stolen.
+	ErrTokenReused = errors.New("token reused")
 )
 
 type Token struct {
-	Plaintext string    `json:"token"`
+	ID        int64     `json:"id,omitempty"`
+	Plaintext string    `json:"token,omitempty"`
 	Hash      []byte    `json:"-"`
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	// FamilyID links together the refresh token and the access tokens which were
+	// issued from a single login, so that they can be revoked together. It is 0
+	// for tokens which don't belong to a family.
+	FamilyID int64 `json:"-"`
+	// Session metadata. These are only meaningful for authentication tokens, where
+	// they let a user see which devices they are logged in from.
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	ClientIP   string    `json:"client_ip,omitempty"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -51,12 +79,18 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 	// we use the WithPadding(base32.NoPadding) method in the line below to omit them.
 	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
 
-	hash := sha256.Sum256([]byte(token.Plaintext))
-	token.Hash = hash[:]
+	token.Hash = hashToken(token.Plaintext)
 
 	return token, nil
 }
 
+// hashToken returns the SHA-256 hash of a plaintext token. Only the hash is stored
+// in the tokens table.
+func hashToken(tokenPlaintext string) []byte {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	return hash[:]
+}
+
 func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 	v.Check(tokenPlaintext != "", "token", "must be provided")
 	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
@@ -66,19 +100,22 @@ type TokenModel struct {
 	DB *sql.DB
 }
 
-// Insert adds the data for specific token to the tokens table
+// Insert adds the data for specific token to the tokens table and set token.ID,
+// token.CreatedAt and token.LastUsedAt using value generated by database
 func (m TokenModel) Insert(token *Token) error {
 	query := `
-	INSERT INTO tokens (hash, user_id, expiry, scope)
-	VALUES ($1, $2, $3, $4)
+	INSERT INTO tokens (hash, user_id, expiry, scope, user_agent, client_ip, family_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id, created_at, last_used_at
 	`
-	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope}
+	familyID := sql.NullInt64{Int64: token.FamilyID, Valid: token.FamilyID != 0}
+
+	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope, token.UserAgent, token.ClientIP, familyID}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	return err
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&token.ID, &token.CreatedAt, &token.LastUsedAt)
 }
 
 // DeleteAllForUser deletes all tokens for a specific user and scope
@@ -94,6 +131,283 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	return err
 }
 
+// Delete deletes the token with a specific scope whose hash matches the
+// provided plaintext token, along with every other token in the same family.
+func (m TokenModel) Delete(scope, tokenPlaintext string) error {
+	query := `
+	DELETE FROM tokens
+	WHERE (hash = $1 AND scope = $2)
+	OR family_id = (SELECT family_id FROM tokens WHERE hash = $1 AND scope = $2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, hashToken(tokenPlaintext), scope)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteForUser deletes the token with a specific ID, scope and owner, along with
+// every other token in the same family.
+func (m TokenModel) DeleteForUser(scope string, userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM tokens
+	WHERE user_id = $3 AND (
+		(id = $1 AND scope = $2)
+		OR family_id = (SELECT family_id FROM tokens WHERE id = $1 AND scope = $2 AND user_id = $3)
+	)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, scope, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllForUser returns all unexpired and unused tokens for a specific user and scope,
+// most recently used first. The token hashes are never selected.
+func (m TokenModel) GetAllForUser(scope string, userID int64) ([]*Token, error) {
+	query := `
+	SELECT id, user_id, expiry, scope, created_at, last_used_at, user_agent, client_ip
+	FROM tokens
+	WHERE scope = $1 AND user_id = $2 AND expiry > $3 AND used_at IS NULL
+	ORDER BY last_used_at DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, scope, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*Token{}
+
+	for rows.Next() {
+		var token Token
+
+		err := rows.Scan(
+			&token.ID,
+			&token.UserID,
+			&token.Expiry,
+			&token.Scope,
+			&token.CreatedAt,
+			&token.LastUsedAt,
+			&token.UserAgent,
+			&token.ClientIP,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, &token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Touch records that a token, and the rest of its family, has just been used. To keep
+// this cheap enough to call on every request, rows are only written when the stored
+// last_used_at value is more than a minute old.
+func (m TokenModel) Touch(scope, tokenPlaintext string) error {
+	query := `
+	UPDATE tokens
+	SET last_used_at = NOW()
+	WHERE (
+		(hash = $1 AND scope = $2)
+		OR family_id = (SELECT family_id FROM tokens WHERE hash = $1 AND scope = $2)
+	)
+	AND last_used_at < NOW() - INTERVAL '1 minute'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, hashToken(tokenPlaintext), scope)
+	return err
+}
+
+// GetFamilyID returns the family ID of the token with a specific scope whose hash
+// matches the provided plaintext token. It is 0 if the token doesn't belong to a family.
+func (m TokenModel) GetFamilyID(scope, tokenPlaintext string) (int64, error) {
+	query := `
+	SELECT family_id
+	FROM tokens
+	WHERE hash = $1 AND scope = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var familyID sql.NullInt64
+
+	err := m.DB.QueryRowContext(ctx, query, hashToken(tokenPlaintext), scope).Scan(&familyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return familyID.Int64, nil
+}
+
+// DeleteOtherSessions deletes the authentication and refresh tokens for a specific
+// user, except those in the given family. Pass a familyID of 0 to delete them all.
+func (m TokenModel) DeleteOtherSessions(userID, familyID int64) error {
+	query := `
+	DELETE FROM tokens
+	WHERE user_id = $1 AND scope = ANY($2) AND ($3::bigint IS NULL OR family_id IS DISTINCT FROM $3)`
+
+	keep := sql.NullInt64{Int64: familyID, Valid: familyID != 0}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array([]string{ScopeAuthentication, ScopeRefresh}), keep)
+	return err
+}
+
+// NewFamily returns a new, unused token family ID.
+func (m TokenModel) NewFamily() (int64, error) {
+	query := `SELECT nextval('token_families_id_seq')`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var familyID int64
+
+	err := m.DB.QueryRowContext(ctx, query).Scan(&familyID)
+	return familyID, err
+}
+
+// DeleteFamily deletes every token in a specific family.
+func (m TokenModel) DeleteFamily(familyID int64) error {
+	query := `
+	DELETE FROM tokens
+	WHERE family_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, familyID)
+	return err
+}
+
+// Consume marks a single-use token as used and returns it. If no matching unused
+// and unexpired token exists then ErrRecordNotFound is returned, unless the token
+// has already been used, in which case its whole family is deleted and
+// ErrTokenReused is returned.
+//
+// Used tokens are kept (rather than deleted) until they expire, precisely so that
+// we can recognise them if they are presented again.
+func (m TokenModel) Consume(scope, tokenPlaintext string) (*Token, error) {
+	query := `
+	UPDATE tokens
+	SET used_at = NOW()
+	WHERE hash = $1 AND scope = $2 AND expiry > $3 AND used_at IS NULL
+	RETURNING id, user_id, expiry, scope, family_id`
+
+	hash := hashToken(tokenPlaintext)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	token := Token{Hash: hash}
+	var familyID sql.NullInt64
+
+	err := m.DB.QueryRowContext(ctx, query, hash, scope, time.Now()).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Expiry,
+		&token.Scope,
+		&familyID,
+	)
+	if err == nil {
+		token.FamilyID = familyID.Int64
+		return &token, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// Check whether the token exists but has already been used.
+	query = `
+	SELECT family_id
+	FROM tokens
+	WHERE hash = $1 AND scope = $2 AND used_at IS NOT NULL`
+
+	err = m.DB.QueryRowContext(ctx, query, hash, scope).Scan(&familyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if familyID.Valid {
+		err = m.DeleteFamily(familyID.Int64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, ErrTokenReused
+}
+
+// NewSession is like New, but it also records the token family and the device
+// metadata of the client which the token is issued to.
+func (m TokenModel) NewSession(userID int64, ttl time.Duration, scope string, familyID int64, userAgent, clientIP string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	token.FamilyID = familyID
+	token.UserAgent = userAgent
+	token.ClientIP = clientIP
+
+	err = m.Insert(token)
+	return token, err
+}
+
 // New is shortcut which  creates a nuew toiken  struct and then inserts the
 // data in the tokens table.
 func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -0,0 +1,148 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/hafizmfadli/go-movie/internal/totp"
+	"github.com/hafizmfadli/go-movie/internal/validator"
+)
+
+// TOTP holds a user's time-based one-time password settings. The secret is stored
+// as soon as the user starts enrolling, but two-factor authentication is only
+// enabled once they have confirmed it with a valid code.
+type TOTP struct {
+	UserID       int64
+	Secret       string
+	Enabled      bool
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+func ValidateTOTPCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(len(code) == totp.Digits, "code", "must be 6 digits long")
+}
+
+type TOTPModel struct {
+	DB *sql.DB
+}
+
+// Get retrieves the TOTP settings for a specific user.
+func (m TOTPModel) Get(userID int64) (*TOTP, error) {
+	query := `
+	SELECT user_id, secret, enabled, last_used_step, created_at
+	FROM users_totp
+	WHERE user_id = $1`
+
+	var t TOTP
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(
+		&t.UserID,
+		&t.Secret,
+		&t.Enabled,
+		&t.LastUsedStep,
+		&t.CreatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &t, nil
+}
+
+// Insert stores a new, not yet enabled, secret for a user. Any previous enrollment
+// which was never confirmed is replaced, but an enabled one is left untouched and
+// ErrEditConflict is returned.
+func (m TOTPModel) Insert(t *TOTP) error {
+	query := `
+	INSERT INTO users_totp (user_id, secret)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE
+	SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+	WHERE users_totp.enabled = false
+	RETURNING enabled, last_used_step, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, t.UserID, t.Secret).Scan(&t.Enabled, &t.LastUsedStep, &t.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Enable turns on two-factor authentication for a specific user.
+func (m TOTPModel) Enable(userID int64) error {
+	query := `
+	UPDATE users_totp
+	SET enabled = true
+	WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// Delete removes the TOTP settings for a specific user, which turns off two-factor
+// authentication.
+func (m TOTPModel) Delete(userID int64) error {
+	query := `
+	DELETE FROM users_totp
+	WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// UseStep records that the code for a specific time step has been used. Because
+// a code is valid for more than one step, we only accept steps later than the last
+// one used. If the step has already been used, ErrEditConflict is returned.
+func (m TOTPModel) UseStep(userID, step int64) error {
+	query := `
+	UPDATE users_totp
+	SET last_used_step = $2
+	WHERE user_id = $1 AND last_used_step < $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
@@ -2,13 +2,13 @@ package data
 
 import (
 	"context"
-	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/hafizmfadli/go-movie/internal/passwords"
 	"github.com/hafizmfadli/go-movie/internal/validator"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -39,36 +39,59 @@ func (u *User) IsAnonymous() bool {
 type password struct {
 	plaintext *string
 	hash      []byte
+	// outdatedHash is the hash which Matches replaced because it was created with an
+	// outdated algorithm or parameters. It is nil unless the new hash needs saving.
+	outdatedHash []byte
 }
 
-// Set calculates the bcrypt hash of plaintext password, and stores both
-// the hash and the plaintext versions in the struct.
+// Set calculates the hash of plaintext password using the current PasswordHasher, and
+// stores both the hash and the plaintext versions in the struct.
 func (p *password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+	hash, err := PasswordHasher.Hash(plaintextPassword)
 	if err != nil {
 		return err
 	}
 	p.plaintext = &plaintextPassword
 	p.hash = hash
+	p.outdatedHash = nil
 
 	return nil
 }
 
 // Matches method checks whether the provided plaintext password matches the
-// hashed password stored in the struct.
+// hashed password stored in the struct. If it does, but the hash is outdated, the
+// password is hashed again with the current PasswordHasher. The caller should then
+// save the new hash with UserModel.UpdatePasswordHash.
 func (p *password) Matches(plaintextPassword string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
+	hasher, err := hasherFor(p.hash)
 	if err != nil {
-		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-			return false, nil
-		default:
+		return false, err
+	}
+
+	match, err := hasher.Matches(plaintextPassword, p.hash)
+	if err != nil || !match {
+		return false, err
+	}
+
+	if hasher != PasswordHasher || PasswordHasher.Outdated(p.hash) {
+		outdatedHash := p.hash
+
+		err = p.Set(plaintextPassword)
+		if err != nil {
 			return false, err
 		}
+
+		p.outdatedHash = outdatedHash
 	}
+
 	return true, nil
 }
 
+// Rehashed reports whether Matches has upgraded the hash, and it needs saving.
+func (p *password) Rehashed() bool {
+	return p.outdatedHash != nil
+}
+
 func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(email != "", "email", "must be provided")
 	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
@@ -80,6 +103,14 @@ func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
 }
 
+// ValidatePasswordStrength checks that a password isn't easy to guess. The user's name
+// and email address are passed on so that passwords built from them are rejected too.
+func ValidatePasswordStrength(v *validator.Validator, password string, user *User) {
+	if weakness := passwords.Weakness(password, user.Name, user.Email); weakness != "" {
+		v.AddError("password", weakness)
+	}
+}
+
 func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(user.Name != "", "name", "must be provided")
 	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
@@ -87,6 +118,7 @@ func ValidateUser(v *validator.Validator, user *User) {
 
 	if user.Password.plaintext != nil {
 		ValidatePasswordPlaintext(v, *user.Password.plaintext)
+		ValidatePasswordStrength(v, *user.Password.plaintext, user)
 	}
 
 	// If the password hash is ever nil, this will be due to a logic error in our
@@ -160,6 +192,44 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
+// Get get user by id
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, created_at, name, email, password_hash, activated, version
+	FROM users
+	WHERE id = $1
+	`
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
 // Update specific user
 func (m UserModel) Update(user *User) error {
 
@@ -189,7 +259,7 @@ func (m UserModel) Update(user *User) error {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
 			return ErrDuplicateEmail
 		case errors.Is(err, sql.ErrNoRows):
-			return ErrRecordNotFound
+			return ErrEditConflict
 		default:
 			return err
 		}
@@ -198,9 +268,93 @@ func (m UserModel) Update(user *User) error {
 	return nil
 }
 
+// UpdatePasswordHash saves a password hash which was upgraded by password.Matches. The
+// hash is only replaced if it hasn't changed in the meantime, and the version isn't
+// incremented because the password itself is the same, so it never causes an edit
+// conflict for anybody else.
+func (m UserModel) UpdatePasswordHash(user *User) error {
+	if !user.Password.Rehashed() {
+		return nil
+	}
+
+	query := `
+	UPDATE users
+	SET password_hash = $1
+	WHERE id = $2 AND password_hash = $3`
+
+	args := []interface{}{user.Password.hash, user.ID, user.Password.outdatedHash}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	user.Password.outdatedHash = nil
+
+	return nil
+}
+
+// GetAll returns users matching the name and email filters, and the activation state
+// if one is given. The name is matched using full-text search, and the email address
+// is matched by substring.
+func (m UserModel) GetAll(name, email string, activated *bool, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, name, email, password_hash, activated, version
+	FROM users
+	WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+	AND (strpos(email, $2) > 0 OR $2 = '')
+	AND (activated = $3 OR $3 IS NULL)
+	ORDER BY %s %s, id ASC
+	LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+
+	args := []interface{}{name, email, activated, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	totalRecords := 0
+
+	for rows.Next() {
+		var user User
+
+		err = rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Password.hash,
+			&user.Activated,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
+
 // GetForToken retrieve the details of the user associated wit a particular activation token.
 func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
-	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
 	SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
@@ -213,7 +367,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	`
 	var user User
 
-	args := []interface{}{tokenHash[:], tokenScope, time.Now()}
+	args := []interface{}{hashToken(tokenPlaintext), tokenScope, time.Now()}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -239,3 +393,90 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 
 	return &user, nil
 }
+
+// ScheduleDeletion marks a user's account to be deleted at a specific time.
+func (m UserModel) ScheduleDeletion(userID int64, at time.Time) error {
+	query := `
+	UPDATE users
+	SET deletion_scheduled_at = $1
+	WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, at, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// CancelDeletion cancels the scheduled deletion of a user's account. If no deletion
+// is scheduled, ErrRecordNotFound is returned.
+func (m UserModel) CancelDeletion(userID int64) error {
+	query := `
+	UPDATE users
+	SET deletion_scheduled_at = NULL
+	WHERE id = $1 AND deletion_scheduled_at IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteScheduled deletes every user whose scheduled deletion time has passed, and
+// returns how many were deleted. Most of what we store about them is removed by the
+// ON DELETE CASCADE foreign keys. The failed logins and magic link requests for their
+// email address aren't linked to the user, so they are deleted in the same statement.
+func (m UserModel) DeleteScheduled() (int64, error) {
+	query := `
+	WITH deleted AS (
+		DELETE FROM users
+		WHERE deletion_scheduled_at <= NOW()
+		RETURNING email
+	), login_failures_deleted AS (
+		DELETE FROM login_failures
+		WHERE kind = $1 AND subject IN (SELECT email FROM deleted)
+	), magic_link_requests_deleted AS (
+		DELETE FROM magic_link_requests
+		WHERE email IN (SELECT email FROM deleted)
+	)
+	SELECT count(*) FROM deleted`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var n int64
+
+	err := m.DB.QueryRowContext(ctx, query, LoginFailureAccount).Scan(&n)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
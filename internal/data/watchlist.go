@@ -0,0 +1,227 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrDuplicateWatchlistEntry is returned when a user adds a movie to their
+	// watchlist which is already on it.
+	ErrDuplicateWatchlistEntry = errors.New("duplicate watchlist entry")
+)
+
+// WatchlistEntry is a movie which a user plans to watch.
+type WatchlistEntry struct {
+	Movie   *Movie    `json:"movie"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+type WatchlistModel struct {
+	DB *sql.DB
+}
+
+// Add adds a movie to a user's watchlist.
+func (m WatchlistModel) Add(userID, movieID int64) (*WatchlistEntry, error) {
+	query := `
+	INSERT INTO watchlist (user_id, movie_id)
+	VALUES ($1, $2)
+	RETURNING added_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	entry := &WatchlistEntry{}
+
+	err := m.DB.QueryRowContext(ctx, query, userID, movieID).Scan(&entry.AddedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "watchlist_pkey"`:
+			return nil, ErrDuplicateWatchlistEntry
+		case err.Error() == `pq: insert or update on table "watchlist" violates foreign key constraint "watchlist_movie_id_fkey"`:
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return entry, nil
+}
+
+// Remove removes a movie from a user's watchlist.
+func (m WatchlistModel) Remove(userID, movieID int64) error {
+	query := `
+	DELETE FROM watchlist
+	WHERE user_id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllForUser retrieves a page of a user's watchlist, along with the movies on it.
+// Movies in the trash are left out until they are restored.
+func (m WatchlistModel) GetAllForUser(userID int64, filters Filters) ([]*WatchlistEntry, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), movies.id, movies.created_at, movies.title, movies.year, movies.runtime,
+	movies.genres, movies.rating, movies.votes, movies.version, watchlist.added_at
+	FROM watchlist
+	INNER JOIN movies ON movies.id = watchlist.movie_id
+	WHERE watchlist.user_id = $1 AND movies.deleted_at IS NULL
+	ORDER BY %s %s, movies.id ASC
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	args := []interface{}{userID, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	entries := []*WatchlistEntry{}
+	totalRecords := 0
+
+	for rows.Next() {
+		entry := WatchlistEntry{Movie: &Movie{}}
+
+		err = rows.Scan(
+			&totalRecords,
+			&entry.Movie.ID,
+			&entry.Movie.CreatedAt,
+			&entry.Movie.Title,
+			&entry.Movie.Year,
+			&entry.Movie.Runtime,
+			pq.Array(&entry.Movie.Genres),
+			&entry.Movie.Rating,
+			&entry.Movie.Votes,
+			&entry.Movie.Version,
+			&entry.AddedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return entries, metadata, nil
+}
+
+// GetAllForExport retrieves a user's whole watchlist, newest first, for the export of
+// their account. Unlike GetAllForUser it isn't paginated, and movies in the trash are
+// included, as the entries are still the user's data.
+func (m WatchlistModel) GetAllForExport(userID int64) ([]*WatchlistEntry, error) {
+	query := `
+	SELECT movies.id, movies.created_at, movies.title, movies.year, movies.runtime,
+	movies.genres, movies.rating, movies.votes, movies.version, watchlist.added_at
+	FROM watchlist
+	INNER JOIN movies ON movies.id = watchlist.movie_id
+	WHERE watchlist.user_id = $1
+	ORDER BY watchlist.added_at DESC, movies.id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*WatchlistEntry{}
+
+	for rows.Next() {
+		entry := WatchlistEntry{Movie: &Movie{}}
+
+		err = rows.Scan(
+			&entry.Movie.ID,
+			&entry.Movie.CreatedAt,
+			&entry.Movie.Title,
+			&entry.Movie.Year,
+			&entry.Movie.Runtime,
+			pq.Array(&entry.Movie.Genres),
+			&entry.Movie.Rating,
+			&entry.Movie.Votes,
+			&entry.Movie.Version,
+			&entry.AddedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Contains reports which of the given movies are on a user's watchlist. Movies which
+// aren't on it are left out of the returned map.
+func (m WatchlistModel) Contains(userID int64, movieIDs []int64) (map[int64]bool, error) {
+	query := `
+	SELECT movie_id
+	FROM watchlist
+	WHERE user_id = $1 AND movie_id = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contains := make(map[int64]bool)
+
+	for rows.Next() {
+		var movieID int64
+
+		err = rows.Scan(&movieID)
+		if err != nil {
+			return nil, err
+		}
+
+		contains[movieID] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return contains, nil
+}
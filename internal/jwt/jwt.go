@@ -0,0 +1,248 @@
+// Package jwt implements the small subset of JSON Web Tokens (RFC 7519) that we need
+// for stateless authentication: compact JWS tokens signed with HS256 or EdDSA
+// (Ed25519), with a "kid" header so that signing keys can be rotated.
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrInvalidToken = errors.New("jwt: invalid token")
+	ErrExpiredToken = errors.New("jwt: token has expired")
+	ErrUnknownKey   = errors.New("jwt: unknown key id")
+)
+
+// RegisteredClaims holds the standard claims which Verify checks. Embed it in your own
+// claims struct.
+type RegisteredClaims struct {
+	Subject   string `json:"sub,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// Key is a named signing key. A Key created from a public key only can be used to
+// verify tokens but not to sign them.
+type Key struct {
+	ID        string
+	Algorithm string
+
+	secret     []byte
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+// NewHS256Key returns a HMAC-SHA256 key. The secret must be at least 32 bytes long.
+func NewHS256Key(id string, secret []byte) (Key, error) {
+	if len(secret) < 32 {
+		return Key{}, fmt.Errorf("jwt: HS256 key %q must be at least 32 bytes long", id)
+	}
+	return Key{ID: id, Algorithm: AlgHS256, secret: secret}, nil
+}
+
+// NewEd25519Key returns an Ed25519 key from a 32 byte private key seed.
+func NewEd25519Key(id string, seed []byte) (Key, error) {
+	if len(seed) != ed25519.SeedSize {
+		return Key{}, fmt.Errorf("jwt: Ed25519 key %q must be a %d byte seed", id, ed25519.SeedSize)
+	}
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	return Key{
+		ID:         id,
+		Algorithm:  AlgEdDSA,
+		privateKey: privateKey,
+		publicKey:  privateKey.Public().(ed25519.PublicKey),
+	}, nil
+}
+
+// NewEd25519PublicKey returns a verify-only Ed25519 key.
+func NewEd25519PublicKey(id string, publicKey []byte) (Key, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return Key{}, fmt.Errorf("jwt: Ed25519 public key %q must be %d bytes long", id, ed25519.PublicKeySize)
+	}
+	return Key{ID: id, Algorithm: AlgEdDSA, publicKey: publicKey}, nil
+}
+
+// ParseKey parses a key in the format "<kid>:<type>:<base64 key>", where type is one
+// of "hs256" (a shared secret), "ed25519" (a private key seed) or "ed25519-public".
+func ParseKey(spec string) (Key, error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return Key{}, errors.New(`jwt: key must be in the format "<kid>:<type>:<base64 key>"`)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Key{}, fmt.Errorf("jwt: key %q is not valid base64: %w", parts[0], err)
+	}
+
+	switch strings.ToLower(parts[1]) {
+	case "hs256":
+		return NewHS256Key(parts[0], raw)
+	case "ed25519":
+		return NewEd25519Key(parts[0], raw)
+	case "ed25519-public":
+		return NewEd25519PublicKey(parts[0], raw)
+	default:
+		return Key{}, fmt.Errorf("jwt: key %q has unsupported type %q", parts[0], parts[1])
+	}
+}
+
+func (k Key) canSign() bool {
+	return k.secret != nil || k.privateKey != nil
+}
+
+func (k Key) sign(input []byte) []byte {
+	if k.Algorithm == AlgHS256 {
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+	return ed25519.Sign(k.privateKey, input)
+}
+
+func (k Key) verify(input, signature []byte) bool {
+	if k.Algorithm == AlgHS256 {
+		return hmac.Equal(k.sign(input), signature)
+	}
+	return ed25519.Verify(k.publicKey, input, signature)
+}
+
+// KeySet holds every key which tokens may be verified with, and the one key which new
+// tokens are signed with. To rotate keys without downtime, add the new key to the set,
+// make it the signing key, and remove the old key once the tokens signed with it have
+// expired.
+type KeySet struct {
+	keys       map[string]Key
+	signingKey Key
+}
+
+// NewKeySet returns a KeySet which signs tokens with the key identified by signingKeyID.
+func NewKeySet(signingKeyID string, keys ...Key) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]Key)}
+
+	for _, key := range keys {
+		if _, exists := ks.keys[key.ID]; exists {
+			return nil, fmt.Errorf("jwt: duplicate key id %q", key.ID)
+		}
+		ks.keys[key.ID] = key
+	}
+
+	signingKey, ok := ks.keys[signingKeyID]
+	if !ok {
+		return nil, fmt.Errorf("jwt: signing key %q is not in the key set", signingKeyID)
+	}
+	if !signingKey.canSign() {
+		return nil, fmt.Errorf("jwt: signing key %q is a public key", signingKeyID)
+	}
+	ks.signingKey = signingKey
+
+	return ks, nil
+}
+
+// Sign marshals claims to JSON and returns them as a signed compact JWT.
+func (ks *KeySet) Sign(claims interface{}) (string, error) {
+	h, err := json.Marshal(header{Algorithm: ks.signingKey.Algorithm, Type: "JWT", KeyID: ks.signingKey.ID})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := encode(h) + "." + encode(payload)
+	signature := ks.signingKey.sign([]byte(input))
+
+	return input + "." + encode(signature), nil
+}
+
+// Verify checks the signature and the registered time claims of a token, and then
+// unmarshals its payload into claims. The algorithm in the token header must match
+// the algorithm of the key it names, so a token can't pick a weaker way of being
+// verified.
+func (ks *KeySet) Verify(token string, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalidToken
+	}
+
+	rawHeader, err := decode(parts[0])
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	var h header
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return ErrInvalidToken
+	}
+
+	key, ok := ks.keys[h.KeyID]
+	if !ok {
+		return ErrUnknownKey
+	}
+	if h.Algorithm != key.Algorithm {
+		return ErrInvalidToken
+	}
+
+	signature, err := decode(parts[2])
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return ErrInvalidToken
+	}
+
+	payload, err := decode(parts[1])
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	var registered RegisteredClaims
+	if err := json.Unmarshal(payload, &registered); err != nil {
+		return ErrInvalidToken
+	}
+
+	now := time.Now().Unix()
+	if registered.ExpiresAt == 0 || now >= registered.ExpiresAt {
+		return ErrExpiredToken
+	}
+	if registered.NotBefore != 0 && now < registered.NotBefore {
+		return ErrInvalidToken
+	}
+
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,560 @@
+// Package oidc implements the relying party side of OpenID Connect that we need for
+// single sign-on: provider discovery, the authorization code flow with PKCE (RFC 7636),
+// and ID token validation against the provider's JSON Web Key Set. ID tokens must be
+// signed with RS256 or ES256.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+var (
+	// ErrInvalidToken is returned when an ID token fails validation.
+	ErrInvalidToken = errors.New("oidc: invalid ID token")
+)
+
+// keysRefreshInterval is the shortest time between two fetches of the provider's keys.
+// A token signed with an unknown key makes us fetch the keys again, in case the
+// provider has rotated them, and this stops bad tokens from making us hammer it.
+const keysRefreshInterval = time.Minute
+
+// Config holds the settings for a single identity provider.
+type Config struct {
+	// Name identifies the provider in our API, for example "google" in
+	// "POST /v1/tokens/oidc/google".
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+}
+
+// Claims holds the ID token claims which we use.
+type Claims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	ExpiresAt       int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce"`
+	Email           string   `json:"email"`
+	EmailVerified   bool     `json:"email_verified"`
+	Name            string   `json:"name"`
+}
+
+// audience is the "aud" claim, which may be either a single string or an array.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// metadata holds the parts of the provider's discovery document which we use.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect identity provider. Its discovery document and keys are
+// fetched when they are first needed, rather than when the Provider is created, so
+// that a provider which is down doesn't stop the API from starting. It is safe for
+// concurrent use.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	// mu guards the fields below. It is never held while talking to the provider, so
+	// that a slow provider only holds up the requests which need it to answer.
+	mu            sync.Mutex
+	metadata      *metadata
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+	// keysFetch is closed when the keys which are being fetched have arrived. It is
+	// nil when no fetch is in progress.
+	keysFetch chan struct{}
+}
+
+// NewProvider returns a Provider for cfg. If client is nil, a client with a 10 second
+// timeout is used.
+func NewProvider(cfg Config, client *http.Client) (*Provider, error) {
+	switch {
+	case cfg.Name == "":
+		return nil, errors.New("oidc: provider name must be provided")
+	case cfg.Issuer == "":
+		return nil, fmt.Errorf("oidc: provider %q must have an issuer", cfg.Name)
+	case cfg.ClientID == "":
+		return nil, fmt.Errorf("oidc: provider %q must have a client ID", cfg.Name)
+	case cfg.RedirectURL == "":
+		return nil, fmt.Errorf("oidc: provider %q must have a redirect URL", cfg.Name)
+	}
+
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Provider{config: cfg, client: client}, nil
+}
+
+// Name returns the name of the provider.
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// AuthCodeURL returns the URL of the provider's authorization endpoint, which the user
+// must be sent to in order to log in. The provider will redirect them back to our
+// redirect URL with the state and an authorization code.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(md.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("oidc: invalid authorization endpoint: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.config.ClientID)
+	q.Set("redirect_uri", p.config.RedirectURL)
+	q.Set("scope", strings.Join(p.config.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", CodeChallenge(codeVerifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange trades an authorization code for an ID token at the provider's token
+// endpoint, validates the ID token, and returns its claims. The nonce must be the
+// one which was sent in the authorization request.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var response struct {
+		IDToken string `json:"id_token"`
+	}
+
+	err = p.do(req, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.IDToken == "" {
+		return nil, errors.New("oidc: token response has no ID token")
+	}
+
+	return p.verify(ctx, response.IDToken, nonce)
+}
+
+// verify checks the signature and claims of an ID token, as described in section
+// 3.1.3.7 of the OpenID Connect Core specification.
+func (p *Provider) verify(ctx context.Context, idToken, nonce string) (*Claims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	rawHeader, err := decode(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var h struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	key, err := p.key(ctx, h.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := decode(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	// The algorithm must match the type of the key, so that a token can't choose a
+	// different way of being verified.
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if h.Algorithm != AlgRS256 || rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return nil, ErrInvalidToken
+		}
+	case *ecdsa.PublicKey:
+		if h.Algorithm != AlgES256 || len(signature) != 64 {
+			return nil, ErrInvalidToken
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return nil, ErrInvalidToken
+		}
+	default:
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := decode(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case claims.Issuer != md.Issuer:
+		return nil, ErrInvalidToken
+	case !claims.Audience.contains(p.config.ClientID):
+		return nil, ErrInvalidToken
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID:
+		// A token for several audiences must say that it was issued to us.
+		return nil, ErrInvalidToken
+	case claims.AuthorizedParty != "" && claims.AuthorizedParty != p.config.ClientID:
+		return nil, ErrInvalidToken
+	case claims.Subject == "":
+		return nil, ErrInvalidToken
+	case claims.ExpiresAt == 0 || time.Now().Unix() >= claims.ExpiresAt:
+		return nil, ErrInvalidToken
+	case nonce == "" || claims.Nonce != nonce:
+		return nil, ErrInvalidToken
+	}
+
+	return &claims, nil
+}
+
+// discover returns the provider's discovery document, fetching it the first time.
+// Concurrent first calls may each fetch it, which is harmless, and the first one to
+// finish is kept.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	md := p.metadata
+	p.mu.Unlock()
+
+	if md != nil {
+		return md, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	md = &metadata{}
+
+	err = p.do(req, md)
+	if err != nil {
+		return nil, err
+	}
+
+	// The issuer in the discovery document must be exactly the one we were configured
+	// with, otherwise one provider could impersonate another.
+	if md.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("oidc: provider %q returned issuer %q", p.config.Name, md.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc: provider %q discovery document is incomplete", p.config.Name)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata == nil {
+		p.metadata = md
+	}
+
+	return p.metadata, nil
+}
+
+// key returns the provider's public key with the given ID. If we don't know the key,
+// the provider's keys are fetched again. Only one fetch runs at a time, and callers
+// which need the keys while it runs wait for its result.
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+
+	for p.keysFetch != nil {
+		if key, ok := p.keys[kid]; ok {
+			p.mu.Unlock()
+			return key, nil
+		}
+
+		done := p.keysFetch
+		p.mu.Unlock()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		p.mu.Lock()
+	}
+
+	if key, ok := p.keys[kid]; ok {
+		p.mu.Unlock()
+		return key, nil
+	}
+
+	if time.Since(p.keysFetchedAt) < keysRefreshInterval {
+		p.mu.Unlock()
+		return nil, ErrInvalidToken
+	}
+
+	done := make(chan struct{})
+	p.keysFetch = done
+	p.mu.Unlock()
+
+	keys, err := p.fetchKeys(ctx, md.JWKSURI)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.keysFetch = nil
+	close(done)
+
+	// After a failed fetch the next caller tries again, rather than waiting for the
+	// refresh interval.
+	if err != nil {
+		return nil, err
+	}
+
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	return key, nil
+}
+
+// fetchKeys fetches the provider's JSON Web Key Set from uri, and returns its signing
+// keys by ID.
+func (p *Provider) fetchKeys(ctx context.Context, uri string) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	err = p.do(req, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+
+	for _, jwk := range set.Keys {
+		// Skip keys that are meant for encryption, or of types we don't support.
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.KeyID] = key
+		}
+	}
+
+	return keys, nil
+}
+
+// do sends a request to the provider and decodes the JSON response into dst.
+func (p *Provider) do(req *http.Request, dst interface{}) error {
+	res, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("oidc: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("oidc: %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s %s returned %s: %s", req.Method, req.URL, res.Status, body)
+	}
+
+	err = json.Unmarshal(body, dst)
+	if err != nil {
+		return fmt.Errorf("oidc: %s %s returned invalid JSON: %w", req.Method, req.URL, err)
+	}
+
+	return nil
+}
+
+// jsonWebKey is a single public key from a JSON Web Key Set (RFC 7517).
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC keys
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("oidc: RSA exponent is too large")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, fmt.Errorf("oidc: unsupported curve %q", k.Curve)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("oidc: EC point is not on the curve")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("oidc: unsupported key type %q", k.KeyType)
+	}
+}
+
+// RandomString returns a random, URL-safe string of 43 characters. It is suitable for
+// the state, the nonce, and the PKCE code verifier.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return encode(b), nil
+}
+
+// CodeChallenge returns the S256 PKCE code challenge for a code verifier.
+func CodeChallenge(codeVerifier string) string {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	return encode(hash[:])
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
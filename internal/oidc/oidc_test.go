@@ -0,0 +1,284 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hafizmfadli/go-movie/internal/oidc"
+	"github.com/hafizmfadli/go-movie/internal/oidc/oidctest"
+)
+
+const (
+	clientID     = "netflix"
+	clientSecret = "pa55word"
+	redirectURL  = "http://localhost:4000/callback"
+)
+
+// authorize runs the authorization request for p against srv, and returns the code
+// which the fake provider redirects back with.
+func authorize(t *testing.T, srv *oidctest.Server, p *oidc.Provider, state, nonce, codeVerifier string) string {
+	t.Helper()
+
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, codeVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("authorization request returned %s", res.Status)
+	}
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(location.String(), redirectURL) {
+		t.Fatalf("redirected to %q; want %q", location, redirectURL)
+	}
+
+	if got := location.Query().Get("state"); got != state {
+		t.Fatalf("redirected with state %q; want %q", got, state)
+	}
+
+	return location.Query().Get("code")
+}
+
+func newProvider(t *testing.T, srv *oidctest.Server) *oidc.Provider {
+	t.Helper()
+
+	p, err := oidc.NewProvider(oidc.Config{
+		Name:         "test",
+		Issuer:       srv.URL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+	}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestExchange(t *testing.T) {
+	srv := oidctest.NewServer(clientID, clientSecret)
+	defer srv.Close()
+
+	p := newProvider(t, srv)
+
+	state, nonce, codeVerifier := "state", "nonce", "code-verifier"
+
+	code := authorize(t, srv, p, state, nonce, codeVerifier)
+
+	claims, err := p.Exchange(context.Background(), code, codeVerifier, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Subject != srv.Subject {
+		t.Errorf("got subject %q; want %q", claims.Subject, srv.Subject)
+	}
+	if claims.Email != srv.Email || !claims.EmailVerified {
+		t.Errorf("got email %q (verified %t); want %q (verified)", claims.Email, claims.EmailVerified, srv.Email)
+	}
+	if claims.Name != srv.Name {
+		t.Errorf("got name %q; want %q", claims.Name, srv.Name)
+	}
+
+	// Codes can only be used once.
+	_, err = p.Exchange(context.Background(), code, codeVerifier, nonce)
+	if err == nil {
+		t.Error("reused code was accepted")
+	}
+}
+
+func TestExchangeInvalid(t *testing.T) {
+	tests := []struct {
+		name         string
+		codeVerifier string
+		nonce        string
+		editClaims   func(claims map[string]interface{})
+		editIDToken  func(idToken string) string
+		// wantInvalidToken is set when the token endpoint issues a token, which
+		// Exchange must then reject.
+		wantInvalidToken bool
+	}{
+		{
+			name:         "Wrong code verifier",
+			codeVerifier: "another-code-verifier",
+		},
+		{
+			name:             "Wrong nonce",
+			nonce:            "another-nonce",
+			wantInvalidToken: true,
+		},
+		{
+			name: "Expired",
+			editClaims: func(claims map[string]interface{}) {
+				claims["exp"] = time.Now().Add(-time.Minute).Unix()
+			},
+			wantInvalidToken: true,
+		},
+		{
+			name: "Wrong issuer",
+			editClaims: func(claims map[string]interface{}) {
+				claims["iss"] = "https://attacker.example.com"
+			},
+			wantInvalidToken: true,
+		},
+		{
+			name: "Wrong audience",
+			editClaims: func(claims map[string]interface{}) {
+				claims["aud"] = "another-client"
+			},
+			wantInvalidToken: true,
+		},
+		{
+			name: "Several audiences without azp",
+			editClaims: func(claims map[string]interface{}) {
+				claims["aud"] = []string{clientID, "another-client"}
+			},
+			wantInvalidToken: true,
+		},
+		{
+			name: "Several audiences with another azp",
+			editClaims: func(claims map[string]interface{}) {
+				claims["aud"] = []string{clientID, "another-client"}
+				claims["azp"] = "another-client"
+			},
+			wantInvalidToken: true,
+		},
+		{
+			name: "No subject",
+			editClaims: func(claims map[string]interface{}) {
+				delete(claims, "sub")
+			},
+			wantInvalidToken: true,
+		},
+		{
+			name: "Tampered payload",
+			editIDToken: func(idToken string) string {
+				parts := strings.Split(idToken, ".")
+				parts[1] = parts[1][:len(parts[1])-2] + "AA"
+				return strings.Join(parts, ".")
+			},
+			wantInvalidToken: true,
+		},
+		{
+			name: "No signature",
+			editIDToken: func(idToken string) string {
+				return idToken[:strings.LastIndex(idToken, ".")+1]
+			},
+			wantInvalidToken: true,
+		},
+		{
+			name: "Unsigned",
+			editIDToken: func(idToken string) string {
+				parts := strings.Split(idToken, ".")
+				parts[0] = "eyJhbGciOiJub25lIiwia2lkIjoib2lkY3Rlc3QifQ" // {"alg":"none","kid":"oidctest"}
+				parts[2] = ""
+				return strings.Join(parts, ".")
+			},
+			wantInvalidToken: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := oidctest.NewServer(clientID, clientSecret)
+			defer srv.Close()
+
+			srv.EditClaims = tt.editClaims
+			srv.EditIDToken = tt.editIDToken
+
+			p := newProvider(t, srv)
+
+			state, nonce, codeVerifier := "state", "nonce", "code-verifier"
+
+			code := authorize(t, srv, p, state, nonce, codeVerifier)
+
+			if tt.codeVerifier != "" {
+				codeVerifier = tt.codeVerifier
+			}
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			_, err := p.Exchange(context.Background(), code, codeVerifier, nonce)
+			if err == nil {
+				t.Fatal("invalid exchange was accepted")
+			}
+
+			if tt.wantInvalidToken && !errors.Is(err, oidc.ErrInvalidToken) {
+				t.Errorf("got error %q; want %q", err, oidc.ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestExchangeSeveralAudiencesWithAZP(t *testing.T) {
+	srv := oidctest.NewServer(clientID, clientSecret)
+	defer srv.Close()
+
+	srv.EditClaims = func(claims map[string]interface{}) {
+		claims["aud"] = []string{clientID, "another-client"}
+		claims["azp"] = clientID
+	}
+
+	p := newProvider(t, srv)
+
+	code := authorize(t, srv, p, "state", "nonce", "code-verifier")
+
+	_, err := p.Exchange(context.Background(), code, "code-verifier", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestExchangeConcurrent checks that concurrent first logins share the fetches of the
+// discovery document and keys. Run it with -race.
+func TestExchangeConcurrent(t *testing.T) {
+	srv := oidctest.NewServer(clientID, clientSecret)
+	defer srv.Close()
+
+	p := newProvider(t, srv)
+
+	// The codes are fetched with a separate provider, so that p hasn't fetched
+	// anything yet when the exchanges start.
+	codes := make([]string, 10)
+	for i := range codes {
+		codes[i] = authorize(t, srv, newProvider(t, srv), "state", "nonce", "code-verifier")
+	}
+
+	errs := make(chan error, len(codes))
+
+	for _, code := range codes {
+		go func(code string) {
+			_, err := p.Exchange(context.Background(), code, "code-verifier", "nonce")
+			errs <- err
+		}(code)
+	}
+
+	for range codes {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
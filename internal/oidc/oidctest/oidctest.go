@@ -0,0 +1,324 @@
+// Package oidctest provides a fake OpenID Connect provider for local development and
+// tests. It approves every authorization request straight away, for a single user
+// whose details can be changed, and issues RS256 signed ID tokens.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const keyID = "oidctest"
+
+// Provider is a fake OpenID Connect provider. It implements http.Handler.
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+
+	// The user who is logged in to the provider.
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+
+	// EditClaims, if set, is called with the claims of each ID token before it is
+	// signed, so that tests can make the provider issue invalid tokens.
+	EditClaims func(claims map[string]interface{})
+	// EditIDToken, if set, is called with each signed ID token and the result is issued
+	// instead, so that tests can tamper with tokens after they are signed.
+	EditIDToken func(idToken string) string
+
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authRequest
+}
+
+// authRequest holds the parameters of an authorization request, until its code is
+// exchanged at the token endpoint.
+type authRequest struct {
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	subject       string
+	email         string
+	emailVerified bool
+	name          string
+	expiry        time.Time
+}
+
+// NewProvider returns a fake provider with the given issuer URL and client
+// credentials, and a default user.
+func NewProvider(issuer, clientID, clientSecret string) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Provider{
+		Issuer:        strings.TrimSuffix(issuer, "/"),
+		ClientID:      clientID,
+		ClientSecret:  clientSecret,
+		Subject:       "1234567890",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		Name:          "Alice Smith",
+		key:           key,
+		codes:         make(map[string]authRequest),
+	}
+
+	return p, nil
+}
+
+// Server is a fake provider running on a local httptest.Server.
+type Server struct {
+	*Provider
+	*httptest.Server
+}
+
+// NewServer starts a fake provider on a local port. The caller should call Close when
+// finished, to shut it down.
+func NewServer(clientID, clientSecret string) *Server {
+	p, err := NewProvider("", clientID, clientSecret)
+	if err != nil {
+		panic("oidctest: " + err.Error())
+	}
+
+	srv := httptest.NewServer(p)
+	p.Issuer = srv.URL
+
+	return &Server{Provider: p, Server: srv}
+}
+
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		p.discovery(w, r)
+	case "/jwks":
+		p.jwks(w, r)
+	case "/authorize":
+		p.authorize(w, r)
+	case "/token":
+		p.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.Issuer,
+		"authorization_endpoint":                p.Issuer + "/authorize",
+		"token_endpoint":                        p.Issuer + "/token",
+		"jwks_uri":                              p.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   encode(p.key.N.Bytes()),
+			"e":   encode(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize approves the request straight away and redirects back to the client with
+// an authorization code.
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	switch {
+	case q.Get("response_type") != "code":
+		http.Error(w, "unsupported response_type", http.StatusBadRequest)
+		return
+	case q.Get("client_id") != p.ClientID:
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirectURI.String() == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+
+	p.mu.Lock()
+	p.codes[code] = authRequest{
+		redirectURI:   q.Get("redirect_uri"),
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+		subject:       p.Subject,
+		email:         p.Email,
+		emailVerified: p.EmailVerified,
+		name:          p.Name,
+		expiry:        time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// token exchanges an authorization code for an ID token. Each code can only be used
+// once.
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	if clientID != p.ClientID || clientSecret != p.ClientSecret {
+		tokenError(w, "invalid_client")
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+
+	p.mu.Lock()
+	req, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	switch {
+	case !ok || time.Now().After(req.expiry):
+		tokenError(w, "invalid_grant")
+		return
+	case r.PostForm.Get("redirect_uri") != req.redirectURI:
+		tokenError(w, "invalid_grant")
+		return
+	case challenge(r.PostForm.Get("code_verifier")) != req.codeChallenge:
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+
+	claims := map[string]interface{}{
+		"iss":            p.Issuer,
+		"sub":            req.subject,
+		"aud":            p.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          req.nonce,
+		"email":          req.email,
+		"email_verified": req.emailVerified,
+		"name":           req.name,
+	}
+
+	if p.EditClaims != nil {
+		p.EditClaims(claims)
+	}
+
+	idToken, err := p.sign(claims)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if p.EditIDToken != nil {
+		idToken = p.EditIDToken(idToken)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (p *Provider) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := encode(header) + "." + encode(payload)
+	digest := sha256.Sum256([]byte(input))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return input + "." + encode(signature), nil
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("oidctest: " + err.Error())
+	}
+	return encode(b)
+}
+
+func challenge(codeVerifier string) string {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	return encode(hash[:])
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
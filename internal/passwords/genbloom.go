@@ -0,0 +1,60 @@
+//go:build ignore
+
+// genbloom builds the bundled Bloom filter of breached passwords from a list with one
+// password per line. Run it with "go generate ./internal/passwords". To check against
+// a bigger breach corpus, run it by hand on that corpus instead:
+//
+//	go run genbloom.go -in breached.txt -out breached.bloom -fp 0.001
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/hafizmfadli/go-movie/internal/bloom"
+)
+
+func main() {
+	in := flag.String("in", "common-passwords.txt", "List of breached passwords, one per line")
+	out := flag.String("out", "breached.bloom", "Output file")
+	fp := flag.Float64("fp", 0.001, "False positive rate")
+	flag.Parse()
+
+	src, err := os.Open(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer src.Close()
+
+	var list []string
+
+	scanner := bufio.NewScanner(src)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			list = append(list, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	filter := bloom.New(len(list), *fp)
+	for _, password := range list {
+		filter.Add(password)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	_, err = filter.WriteTo(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("wrote %d passwords to %s", len(list), *out)
+}
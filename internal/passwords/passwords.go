@@ -0,0 +1,159 @@
+// Package passwords checks how easy passwords are to guess. It rejects passwords which
+// have appeared in data breaches, passwords built from the user's own details, and
+// passwords made of simple patterns.
+package passwords
+
+import (
+	_ "embed"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hafizmfadli/go-movie/internal/bloom"
+)
+
+//go:generate go run genbloom.go -in common-passwords.txt -out breached.bloom
+
+//go:embed breached.bloom
+var breachedBloom []byte
+
+var breached = mustReadFilter(breachedBloom)
+
+func mustReadFilter(b []byte) *bloom.Filter {
+	f, err := bloom.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// minDistinctRunes is the fewest different characters a password may contain.
+const minDistinctRunes = 5
+
+// minPersonalLength is the shortest part of the user's name or email address which a
+// password is checked for. Shorter parts match too many passwords by accident.
+const minPersonalLength = 3
+
+// keyboardRows are checked for runs of neighbouring keys, such as "asdfgh".
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+	"1qaz2wsx3edc4rfv5tgb6yhn7ujm8ik,9ol.0p;/",
+}
+
+// Breached reports whether the password has appeared in a data breach. This is checked
+// against a Bloom filter, so about one in a thousand other passwords are reported as
+// breached too.
+func Breached(password string) bool {
+	return breached.Contains(password) || breached.Contains(strings.ToLower(password))
+}
+
+// Weakness returns why the password is easy to guess, or "" if it isn't. personal holds
+// the user's own details, such as their name and email address, which the password
+// must not contain.
+func Weakness(password string, personal ...string) string {
+	lower := strings.ToLower(password)
+
+	if containsPersonal(lower, personal) {
+		return "must not contain your name or email address"
+	}
+
+	if distinctRunes(lower) < minDistinctRunes {
+		return "must contain at least 5 different characters"
+	}
+
+	if isRepeated(lower) {
+		return "must not be a repeated pattern"
+	}
+
+	if isSequence(lower) {
+		return "must not be a sequence of characters"
+	}
+
+	if Breached(password) {
+		return "is too common, it has appeared in a data breach"
+	}
+
+	return ""
+}
+
+// containsPersonal reports whether password contains any part of the personal details.
+// Names are split into words, and email addresses are checked by their local part.
+func containsPersonal(password string, personal []string) bool {
+	for _, p := range personal {
+		p = strings.ToLower(p)
+
+		if i := strings.LastIndex(p, "@"); i >= 0 {
+			p = p[:i]
+		}
+
+		parts := strings.FieldsFunc(p, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+
+		for _, part := range parts {
+			if utf8.RuneCountInString(part) >= minPersonalLength && strings.Contains(password, part) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func distinctRunes(s string) int {
+	seen := make(map[rune]bool)
+	for _, r := range s {
+		seen[r] = true
+	}
+	return len(seen)
+}
+
+// isRepeated reports whether s is a shorter string repeated, like "abcabcabc".
+func isRepeated(s string) bool {
+	for n := 1; n <= len(s)/2; n++ {
+		if len(s)%n == 0 && strings.Repeat(s[:n], len(s)/n) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// isSequence reports whether s is a run of consecutive characters, like "34567890" or
+// "hgfedcba", or of neighbouring keys on the keyboard, like "qwertyui".
+func isSequence(s string) bool {
+	runes := []rune(s)
+
+	for _, step := range []rune{1, -1} {
+		consecutive := true
+		for i := 1; i < len(runes); i++ {
+			diff := runes[i] - runes[i-1]
+			// Digits wrap around, so that "7890" counts as a sequence.
+			if diff != step && !(runes[i-1] == '9' && runes[i] == '0' && step == 1) && !(runes[i-1] == '0' && runes[i] == '9' && step == -1) {
+				consecutive = false
+				break
+			}
+		}
+		if consecutive {
+			return true
+		}
+	}
+
+	for _, row := range keyboardRows {
+		if strings.Contains(row, s) || strings.Contains(reverse(row), s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
@@ -0,0 +1,6 @@
+CREATE SEQUENCE IF NOT EXISTS token_families_id_seq;
+
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS family_id bigint;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS used_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS tokens_family_id_idx ON tokens (family_id);
\ No newline at end of file
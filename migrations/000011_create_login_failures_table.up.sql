@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS login_failures (
+  kind text NOT NULL,
+  subject citext NOT NULL,
+  failures integer NOT NULL DEFAULT 0,
+  last_failure_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  locked_until timestamp(0) with time zone,
+  PRIMARY KEY (kind, subject)
+);
+
+-- Admins need users:admin to see and clear the lock state. permissions.code isn't
+-- unique, so the permission is only added if it doesn't exist yet.
+INSERT INTO permissions (code)
+SELECT 'users:admin'
+WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE code = 'users:admin');
\ No newline at end of file
@@ -0,0 +1,2 @@
+-- users:admin belongs to 000011, whose down migration removes it.
+SELECT 1;
\ No newline at end of file
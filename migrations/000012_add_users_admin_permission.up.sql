@@ -0,0 +1,5 @@
+-- users:admin is created by 000011 now, which was the first migration to need it. This
+-- only adds it to databases which didn't get it from there.
+INSERT INTO permissions (code)
+SELECT 'users:admin'
+WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE code = 'users:admin');
\ No newline at end of file
@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS roles (
+  id bigserial PRIMARY KEY,
+  name text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+  role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+  permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+  PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS users_roles (
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+  PRIMARY KEY (user_id, role_id)
+);
+
+-- The admin role bundles users:admin, so make sure it exists even if this migration
+-- runs without the earlier one which adds it.
+INSERT INTO permissions (code)
+SELECT 'users:admin'
+WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE code = 'users:admin');
+
+-- Add the default roles and the permissions they bundle.
+INSERT INTO roles (name)
+VALUES
+('viewer'),
+('editor'),
+('admin');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE (roles.name = 'viewer' AND permissions.code = 'movies:read')
+OR (roles.name = 'editor' AND permissions.code IN ('movies:read', 'movies:write'))
+OR (roles.name = 'admin' AND permissions.code IN ('movies:read', 'movies:write', 'users:admin'));
\ No newline at end of file
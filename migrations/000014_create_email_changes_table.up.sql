@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS email_changes (
+  token_hash bytea PRIMARY KEY REFERENCES tokens (hash) ON DELETE CASCADE,
+  email citext NOT NULL
+);
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS invitations (
+  id bigserial PRIMARY KEY,
+  hash bytea UNIQUE NOT NULL,
+  email citext NOT NULL,
+  permissions text[] NOT NULL,
+  expiry timestamp(0) with time zone NOT NULL,
+  created_by bigint REFERENCES users ON DELETE SET NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  accepted_at timestamp(0) with time zone
+);
\ No newline at end of file
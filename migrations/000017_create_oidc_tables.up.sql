@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS oidc_states (
+  hash bytea PRIMARY KEY,
+  provider text NOT NULL,
+  nonce text NOT NULL,
+  code_verifier text NOT NULL,
+  expiry timestamp(0) with time zone NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+  provider text NOT NULL,
+  subject text NOT NULL,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  email citext NOT NULL DEFAULT '',
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities (user_id);
\ No newline at end of file
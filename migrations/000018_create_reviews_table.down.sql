@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS reviews;
+DROP FUNCTION IF EXISTS update_movie_rating();
+ALTER TABLE movies DROP COLUMN IF EXISTS score_total;
+ALTER TABLE movies DROP COLUMN IF EXISTS votes;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating;
\ No newline at end of file
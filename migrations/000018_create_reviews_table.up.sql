@@ -0,0 +1,51 @@
+CREATE TABLE IF NOT EXISTS reviews (
+  id bigserial PRIMARY KEY,
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  score integer NOT NULL,
+  body text NOT NULL DEFAULT '',
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  version integer NOT NULL DEFAULT 1,
+  CONSTRAINT reviews_movie_id_user_id_key UNIQUE (movie_id, user_id),
+  CONSTRAINT reviews_score_check CHECK (score BETWEEN 1 AND 10)
+);
+
+CREATE INDEX IF NOT EXISTS reviews_user_id_idx ON reviews (user_id);
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating double precision NOT NULL DEFAULT 0;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS votes integer NOT NULL DEFAULT 0;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS score_total bigint NOT NULL DEFAULT 0;
+
+-- The rating and vote count of a movie are kept up to date by a trigger, so that
+-- they are also correct after reviews are deleted along with their user. Each review
+-- is added to or taken away from the running totals on the movie row, rather than the
+-- totals being recounted, because the UPDATE locks the row and so concurrent reviews
+-- of the same movie can't overwrite each other's changes.
+CREATE OR REPLACE FUNCTION update_movie_rating() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP IN ('DELETE', 'UPDATE') THEN
+    UPDATE movies
+    SET votes = votes - 1,
+        score_total = score_total - OLD.score,
+        rating = COALESCE((score_total - OLD.score)::double precision / NULLIF(votes - 1, 0), 0)
+    WHERE id = OLD.movie_id;
+  END IF;
+
+  IF TG_OP IN ('INSERT', 'UPDATE') THEN
+    UPDATE movies
+    SET votes = votes + 1,
+        score_total = score_total + NEW.score,
+        rating = (score_total + NEW.score)::double precision / (votes + 1)
+    WHERE id = NEW.movie_id;
+  END IF;
+
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER reviews_update_movie_rating
+AFTER INSERT OR UPDATE OF movie_id, score OR DELETE ON reviews
+FOR EACH ROW EXECUTE FUNCTION update_movie_rating();
+
+CREATE INDEX IF NOT EXISTS movies_rating_idx ON movies (rating);
\ No newline at end of file
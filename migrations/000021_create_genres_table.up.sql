@@ -0,0 +1,77 @@
+CREATE TABLE IF NOT EXISTS genres (
+  slug text PRIMARY KEY,
+  name text NOT NULL,
+  aliases text[] NOT NULL DEFAULT '{}',
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO genres (slug, name, aliases) VALUES
+  ('action', 'Action', '{}'),
+  ('adventure', 'Adventure', '{}'),
+  ('animation', 'Animation', '{"animated", "anime", "cartoon"}'),
+  ('biography', 'Biography', '{"biopic", "biographical"}'),
+  ('comedy', 'Comedy', '{"comedies", "funny"}'),
+  ('crime', 'Crime', '{"gangster", "heist"}'),
+  ('documentary', 'Documentary', '{"doc", "docs", "documentaries"}'),
+  ('drama', 'Drama', '{"dramas"}'),
+  ('family', 'Family', '{"kids", "children"}'),
+  ('fantasy', 'Fantasy', '{}'),
+  ('history', 'History', '{"historical"}'),
+  ('horror', 'Horror', '{}'),
+  ('music', 'Music', '{"musical", "musicals"}'),
+  ('mystery', 'Mystery', '{}'),
+  ('romance', 'Romance', '{"romantic", "romcom", "rom-com", "romantic comedy"}'),
+  ('science-fiction', 'Science Fiction', '{"sci-fi", "scifi", "sf", "science fiction"}'),
+  ('sport', 'Sport', '{"sports"}'),
+  ('thriller', 'Thriller', '{"suspense"}'),
+  ('war', 'War', '{}'),
+  ('western', 'Western', '{"westerns"}')
+ON CONFLICT (slug) DO NOTHING;
+
+-- genre_slug turns a free-text genre into the slug format, e.g. "Film Noir" into
+-- "film-noir". It is only needed while the existing movies are normalized.
+CREATE FUNCTION genre_slug(genre text) RETURNS text AS $$
+  SELECT trim(both '-' from regexp_replace(lower(genre), '[^a-z0-9]+', '-', 'g'))
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Slugs only keep ASCII letters and digits, so a genre without any, such as "ドラマ",
+-- has an empty slug and can't be matched or added to the taxonomy. Rather than drop
+-- such genres from their movies, the migration fails until they are renamed by hand.
+DO $$
+DECLARE
+  genre text;
+BEGIN
+  SELECT g INTO genre
+  FROM movies, unnest(movies.genres) AS g
+  WHERE genre_slug(g) = ''
+  LIMIT 1;
+
+  IF FOUND THEN
+    RAISE EXCEPTION 'movie genre % has no slug, rename it to use ASCII letters or digits', quote_literal(genre);
+  END IF;
+END
+$$;
+
+-- Genres are matched by comparing their slugs, so that case, spacing and punctuation
+-- don't matter. Genres which don't match the slug, name or an alias of a known genre
+-- are added to the taxonomy, so that no movie loses any of its genres.
+INSERT INTO genres (slug, name)
+SELECT DISTINCT genre_slug(g), initcap(trim(g))
+FROM movies, unnest(movies.genres) AS g
+WHERE NOT EXISTS (
+  SELECT 1 FROM genres
+  WHERE genre_slug(g) IN (genres.slug, genre_slug(genres.name))
+  OR genre_slug(g) IN (SELECT genre_slug(a) FROM unnest(genres.aliases) AS a)
+)
+ON CONFLICT (slug) DO NOTHING;
+
+UPDATE movies SET genres = ARRAY(
+  SELECT genres.slug
+  FROM unnest(movies.genres) WITH ORDINALITY AS m(g, n)
+  INNER JOIN genres ON genre_slug(m.g) IN (genres.slug, genre_slug(genres.name))
+  OR genre_slug(m.g) IN (SELECT genre_slug(a) FROM unnest(genres.aliases) AS a)
+  GROUP BY genres.slug
+  ORDER BY min(m.n)
+);
+
+DROP FUNCTION genre_slug(text);
\ No newline at end of file
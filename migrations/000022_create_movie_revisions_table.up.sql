@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS movie_revisions (
+  id bigserial PRIMARY KEY,
+  movie_id bigint NOT NULL,
+  version integer NOT NULL,
+  action text NOT NULL,
+  user_id bigint REFERENCES users ON DELETE SET NULL,
+  snapshot jsonb NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS movie_revisions_movie_id_idx ON movie_revisions (movie_id, version);
+
+-- Existing movies get a revision for their current state, so that later changes can
+-- be diffed against it. Who created them isn't known.
+INSERT INTO movie_revisions (movie_id, version, action, snapshot, created_at)
+SELECT id, version, 'insert', jsonb_build_object('title', title, 'year', year, 'runtime', runtime, 'genres', genres), created_at
+FROM movies;
\ No newline at end of file
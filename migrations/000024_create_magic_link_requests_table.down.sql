@@ -0,0 +1 @@
+DROP TABLE IF EXISTS magic_link_requests;
\ No newline at end of file
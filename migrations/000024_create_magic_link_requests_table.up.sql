@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS magic_link_requests (
+  email citext PRIMARY KEY,
+  requests integer NOT NULL DEFAULT 0,
+  window_started_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
\ No newline at end of file